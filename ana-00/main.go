@@ -6,6 +6,8 @@ import (
 	"math"
 	"path/filepath"
 	"sort"
+
+	"github.com/lsst-france/fp-ana/lsst"
 )
 
 const (
@@ -34,9 +36,17 @@ func main() {
 	}
 	fnames := make([]string, 0, 36)
 	for i := 0; i < 36; i++ {
-		ff, err := filepath.Glob(cfg.Dir + fmt.Sprintf("/*-%02d.fits", i))
-		if err != nil {
-			panic(err)
+		var ff []string
+		// try the uncompressed file first, then its compressed variants
+		for _, suffix := range lsst.Suffixes {
+			var err error
+			ff, err = filepath.Glob(cfg.Dir + fmt.Sprintf("/*-%02d.fits%s", i, suffix))
+			if err != nil {
+				panic(err)
+			}
+			if len(ff) > 0 {
+				break
+			}
 		}
 		if len(ff) != 1 {
 			panic(fmt.Errorf("invalid number of files. got=%d. want=1", len(ff)))
@@ -2,11 +2,10 @@ package main
 
 import (
 	"fmt"
-	"io"
-	"os"
 	"sync"
 
 	fits "github.com/astrogo/fitsio"
+	"github.com/lsst-france/fp-ana/lsst"
 )
 
 type Result struct {
@@ -22,8 +21,7 @@ type Worker interface {
 
 type workerBase struct {
 	fname string // input file name to analyze
-	r     io.ReadCloser
-	f     *fits.File
+	f     *lsst.FitsFile
 	tbl   *fits.Table
 
 	data chan Result
@@ -33,13 +31,7 @@ type workerBase struct {
 func (wrk *workerBase) Start() error {
 	var err error
 
-	r, err := os.Open(wrk.fname)
-	if err != nil {
-		return err
-	}
-	wrk.r = r
-
-	f, err := fits.Open(r)
+	f, err := lsst.OpenFITS(wrk.fname)
 	if err != nil {
 		return err
 	}
@@ -51,12 +43,11 @@ func (wrk *workerBase) Start() error {
 
 func (wrk *workerBase) Stop() error {
 	var err error
-	defer wrk.r.Close()
-	defer wrk.f.Close()
 
 	err = wrk.tbl.Close()
 	if err != nil {
 		fmt.Printf("*** error: [%T] - table %v\n", wrk, err)
+		wrk.f.Close()
 		return err
 	}
 
@@ -66,12 +57,6 @@ func (wrk *workerBase) Stop() error {
 		return err
 	}
 
-	// err = wrk.r.Close()
-	// if err != nil {
-	// 	fmt.Printf("*** error: [%T] - os-file %v\n", wrk, err)
-	// 	return err
-	// }
-
 	return err
 }
 
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	fits "github.com/astrogo/fitsio"
+	"github.com/lsst-france/fp-ana/lsst"
+)
+
+type lcbuilder struct {
+	*lsst.Processor
+
+	Sources *lsst.SourceReader
+	Epochs  *lsst.Epochs
+	Filters map[int]bool // selected filters (nil: all filters)
+
+	// measurements are kept in memory and spilled to disk (see LightCurveOptions.)
+	LightCurves lsst.LightCurveOptions
+	samples     *lsst.SampleStore // measurements of each object
+
+	NbMeasures    int
+	NbBadMeasures int
+	NbMeasuresIn  int
+	NbNoEpoch     int // number of files without a known epoch
+	NbObjects     int
+}
+
+func NewLCBuilder(name string) lsst.P {
+	epochs, _ := lsst.NewEpochs(lsst.EpochOptions{})
+	proc := &lcbuilder{
+		Processor:   lsst.NewProcessor(name),
+		Sources:     lsst.NewSourceReader(""),
+		Epochs:      epochs,
+		LightCurves: lsst.LightCurveOptions{}.WithDefaults(),
+	}
+
+	proc.Config = proc.config
+	proc.Start = proc.start
+	proc.Map = proc.read
+	proc.Reduce = proc.merge
+	proc.Stop = proc.stop
+	proc.Checkpointer = proc
+
+	return proc
+}
+
+func (proc *lcbuilder) config(opts lsst.Options) error {
+	var err error
+	cfg, ok := opts.(lsst.FileOptions)
+	if !ok {
+		return err
+	}
+
+	proc.Sources = lsst.NewSourceReader(cfg.FluxErr)
+
+	proc.Epochs, err = lsst.NewEpochs(cfg.Epoch)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Filters) > 0 {
+		proc.Filters = make(map[int]bool, len(cfg.Filters))
+		for _, name := range cfg.Filters {
+			b, err := proc.FilterSet.Parse(name)
+			if err != nil {
+				return err
+			}
+			id, _ := proc.FilterSet.ID(b)
+			proc.Filters[id] = true
+		}
+	}
+
+	proc.LightCurves = cfg.LightCurves.WithDefaults()
+
+	return err
+}
+
+func (proc *lcbuilder) start() error {
+	var err error
+	proc.samples = lsst.NewSampleStore(
+		filepath.Join(proc.OutputDir, "samples"),
+		proc.LightCurves.MaxSamples,
+		proc.LightCurves.Partitions,
+	)
+
+	proc.Infof("filters:   %v\n", proc.Filters)
+	proc.Infof("epoch key: %s (#runs=%d)\n", proc.Epochs.Key, len(proc.Epochs.Runs))
+	return err
+}
+
+// lcfile holds the rows of a forced-photometry file, at the epoch of the file.
+type lcfile struct {
+	filter int
+	mjd    float64 // epoch of the file (0: unknown)
+	rows   []lsst.Source
+}
+
+// read reads all the rows of a forced-photometry file and its epoch.
+// read is run concurrently on multiple files.
+func (proc *lcbuilder) read(f lsst.File) (interface{}, error) {
+	filter, err := proc.FilterSet.ID(f.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if proc.Filters != nil && !proc.Filters[filter] {
+		// filter not selected
+		return nil, nil
+	}
+
+	ff, err := lsst.OpenFITS(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer ff.Close()
+
+	// measurements without a known epoch are counted and skipped by merge.
+	mjd, err := proc.Epochs.MJD(f, ff)
+	if err != nil {
+		proc.Debugf("%v\n", err)
+		mjd = 0
+		err = nil
+	}
+
+	table, err := ff.Table()
+	if err != nil {
+		return nil, err
+	}
+	if !proc.Sources.HasFluxErr(table) {
+		proc.Warnf("no flux error column %q in [%s]: weighted statistics skipped\n",
+			proc.Sources.FluxErr, f.Name,
+		)
+	}
+	rows, err := proc.Sources.Read(table)
+	if err != nil {
+		return nil, err
+	}
+
+	return lcfile{filter: filter, mjd: mjd, rows: rows}, err
+}
+
+// merge adds the measurements of a file to the light curves.
+// merge is called sequentially, in the order of the input files.
+func (proc *lcbuilder) merge(f lsst.File, v interface{}) error {
+	var err error
+	if v == nil {
+		return err
+	}
+
+	data := v.(lcfile)
+	if data.mjd == 0 {
+		proc.NbNoEpoch += 1
+	}
+	for _, row := range data.rows {
+		proc.NbMeasures += 1
+		if math.IsInf(row.Flux, 0) || math.IsNaN(row.Flux) {
+			proc.NbBadMeasures += 1
+			continue
+		}
+
+		radec := row.RaDec()
+		if !proc.Region.Contains(radec) {
+			continue
+		}
+		if data.mjd == 0 {
+			continue
+		}
+		proc.NbMeasuresIn += 1
+
+		err = proc.samples.Add(row.OID, data.filter, lsst.Sample{
+			Flux:    row.Flux,
+			FluxErr: row.FluxErr,
+			MJD:     data.mjd,
+			RaDec:   radec,
+			Run:     int32(f.Run),
+			Field:   int32(f.Field),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// lcState is the state of a lcbuilder saved in checkpoints.
+type lcState struct {
+	Samples []int64 // sizes of the sample files
+
+	NbMeasures    int
+	NbBadMeasures int
+	NbMeasuresIn  int
+	NbNoEpoch     int
+}
+
+// Checkpoint implements lsst.Checkpointer
+func (proc *lcbuilder) Checkpoint(w io.Writer) error {
+	samples, err := proc.samples.Checkpoint()
+	if err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(lcState{
+		Samples:       samples,
+		NbMeasures:    proc.NbMeasures,
+		NbBadMeasures: proc.NbBadMeasures,
+		NbMeasuresIn:  proc.NbMeasuresIn,
+		NbNoEpoch:     proc.NbNoEpoch,
+	})
+}
+
+// Restore implements lsst.Checkpointer
+func (proc *lcbuilder) Restore(r io.Reader) error {
+	var state lcState
+	err := gob.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return err
+	}
+
+	err = proc.samples.Restore(state.Samples)
+	if err != nil {
+		return err
+	}
+
+	proc.NbMeasures = state.NbMeasures
+	proc.NbBadMeasures = state.NbBadMeasures
+	proc.NbMeasuresIn = state.NbMeasuresIn
+	proc.NbNoEpoch = state.NbNoEpoch
+	return err
+}
+
+// LCPoint is a measurement of a light curve.
+type LCPoint struct {
+	OID     int64      `fits:"objectId"`
+	Filter  int32      `fits:"filter"` // filter index in the filter set
+	MJD     float64    `fits:"mjd"`
+	Run     int32      `fits:"run"`
+	Field   int32      `fits:"field"`
+	Coord   [2]float64 `fits:"coord"` // ra, dec in degrees
+	Flux    float64    `fits:"flux"`
+	FluxErr float64    `fits:"flux_err"`
+}
+
+// LCIndex locates the light curve of an object in the table of measurements.
+type LCIndex struct {
+	OID   int64 `fits:"objectId"`
+	Row   int64 `fits:"row"`   // first row of the light curve
+	NRows int64 `fits:"nrows"` // number of measurements of the light curve
+}
+
+type lcIndices []LCIndex
+
+func (p lcIndices) Len() int           { return len(p) }
+func (p lcIndices) Less(i, j int) bool { return p[i].OID < p[j].OID }
+func (p lcIndices) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type lcPoints []LCPoint
+
+func (p lcPoints) Len() int      { return len(p) }
+func (p lcPoints) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p lcPoints) Less(i, j int) bool {
+	if p[i].MJD != p[j].MJD {
+		return p[i].MJD < p[j].MJD
+	}
+	return p[i].Filter < p[j].Filter
+}
+
+func (proc *lcbuilder) stop() error {
+	var err error
+	proc.Infof("--- light-curve builder stats ---\n")
+	proc.Infof(" #measures:  %d\n", proc.NbMeasures)
+	proc.Infof(" #bad-meas:  %d\n", proc.NbBadMeasures)
+	proc.Infof(" #meas-in:   %d\n", proc.NbMeasuresIn)
+	proc.Infof(" #no-epoch:  %d files\n", proc.NbNoEpoch)
+
+	fname := filepath.Join(proc.OutputDir, "lightcurves.fits")
+	proc.Infof("saving light curves to [%s]\n", fname)
+
+	err = proc.write(fname)
+
+	// keep the measurements of an incomplete job, for a later -resume.
+	var e error
+	if proc.Complete() || proc.CheckpointEvery == 0 {
+		e = proc.samples.Remove()
+	} else {
+		e = proc.samples.Close()
+	}
+	if err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	proc.Infof(" #objects:   %d\n", proc.NbObjects)
+	return err
+}
+
+// write writes the light curves to the FITS file fname: the measurements of
+// each object, sorted by epoch, in the "lightcurves" table and the location
+// of each light curve, sorted by object id, in the "index" table.
+func (proc *lcbuilder) write(fname string) error {
+	w, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	fout, err := fits.Create(w)
+	if err != nil {
+		return err
+	}
+
+	phdu, err := fits.NewPrimaryHDU(nil)
+	if err != nil {
+		return fmt.Errorf("error creating PHDU: %v", err)
+	}
+	err = fout.Write(phdu)
+	if err != nil {
+		return err
+	}
+	err = phdu.Close()
+	if err != nil {
+		return err
+	}
+
+	tbl, err := fits.NewTableFrom("lightcurves", LCPoint{}, fits.BINARY_TBL)
+	if err != nil {
+		return err
+	}
+	defer tbl.Close()
+
+	var (
+		index []LCIndex
+		lc    []LCPoint // light curve of the current object
+		nrows int64
+	)
+
+	// flush writes the light curve of the current object.
+	flush := func() error {
+		if len(lc) == 0 {
+			return nil
+		}
+		sort.Stable(lcPoints(lc))
+		for i := range lc {
+			err := tbl.Write(&lc[i])
+			if err != nil {
+				return err
+			}
+		}
+		index = append(index, LCIndex{OID: lc[0].OID, Row: nrows, NRows: int64(len(lc))})
+		nrows += int64(len(lc))
+		lc = lc[:0]
+		return nil
+	}
+
+	// the measurements of an object are iterated over consecutively,
+	// one filter after the other.
+	err = proc.samples.Each(func(oid int64, filter int, samples []lsst.Sample) error {
+		if len(lc) > 0 && lc[0].OID != oid {
+			err := flush()
+			if err != nil {
+				return err
+			}
+		}
+		for _, v := range samples {
+			lc = append(lc, LCPoint{
+				OID:     oid,
+				Filter:  int32(filter),
+				MJD:     v.MJD,
+				Run:     v.Run,
+				Field:   v.Field,
+				Coord:   [2]float64{v.RaDec.Ra, v.RaDec.Dec},
+				Flux:    v.Flux,
+				FluxErr: v.FluxErr,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = flush()
+	if err != nil {
+		return err
+	}
+
+	err = fout.Write(tbl)
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(lcIndices(index))
+	itbl, err := fits.NewTableFrom("index", LCIndex{}, fits.BINARY_TBL)
+	if err != nil {
+		return err
+	}
+	defer itbl.Close()
+
+	for i := range index {
+		err = itbl.Write(&index[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = fout.Write(itbl)
+	if err != nil {
+		return err
+	}
+
+	proc.NbObjects = len(index)
+	return fout.Close()
+}
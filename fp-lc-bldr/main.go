@@ -0,0 +1,82 @@
+// fp-lc-bldr scans a set of forced-photometry FITS files produced by the LSST stack
+// and creates the light curve of each object: its flux in each filter at each epoch.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/lsst-france/fp-ana/lsst"
+)
+
+var (
+	g_config   = flag.String("jobo", "jobo.toml", "job configuration file")
+	g_resume   = flag.Bool("resume", false, "resume an interrupted job from its checkpoint")
+	g_validate = flag.Bool("validate", false, "validate the job configuration file and exit")
+)
+
+func main() {
+
+	flag.Parse()
+
+	fmt.Printf("=== %s ===\n", filepath.Base(os.Args[0]))
+	rc := run()
+
+	os.Exit(rc)
+}
+
+func run() int {
+	var err error
+	app := lsst.App{
+		Procs: []lsst.P{
+			NewLCBuilder("lcbuilder"),
+		},
+	}
+
+	var jobo lsst.FileOptions
+	if *g_config != "" {
+		jobo, err = lsst.ReadJobo(os.Stdout, *g_config)
+		if *g_validate {
+			if err != nil {
+				return 1
+			}
+			return 0
+		}
+		if err != nil {
+			fmt.Printf("**error: %v\n", err)
+			return 1
+		}
+	}
+
+	if *g_resume {
+		jobo.Resume = true
+	}
+
+	err = app.Configure(jobo)
+	if err != nil {
+		fmt.Printf("**error: %v\n", err)
+		return 1
+	}
+
+	// stop processing files on SIGINT/SIGTERM, but still flush outputs.
+	// a second signal kills the job.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+
+	err = app.RunContext(ctx)
+	if err != nil {
+		fmt.Printf("**error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
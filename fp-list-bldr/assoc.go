@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lsst-france/fp-ana/lsst"
+)
+
+// detection is a measurement kept until the end of the job, to be associated
+// with the other measurements of its object by position.
+type detection struct {
+	File    int32 // index of the file, in the order of the input files
+	Run     int32
+	Field   int32
+	Fid     int32
+	MJD     float64
+	ID      int64
+	OID     int64
+	RaDec   lsst.RaDec
+	Flux    float64
+	FluxErr float64
+	RefFlux float64
+}
+
+// associate groups the detections by position, with a friends-of-friends
+// match, and adds them to the list of sources.
+// The objectId of a merged object is the smallest source id of its detections.
+// Objects with more than one detection in a file are reported in
+// ambiguous.txt.
+func (proc *listbuilder) associate() error {
+	dets, err := proc.detections.Load()
+	if err == nil {
+		err = proc.associateDetections(dets)
+	}
+
+	// keep the detections of an incomplete job, for a later -resume.
+	var e error
+	if proc.Complete() || proc.CheckpointEvery == 0 {
+		e = proc.detections.Remove()
+	} else {
+		e = proc.detections.Close()
+	}
+	if err == nil {
+		err = e
+	}
+	return err
+}
+
+func (proc *listbuilder) associateDetections(dets []detection) error {
+	var err error
+	radius := proc.Association.MatchRadius
+	proc.Infof("associating %d detections (match radius: %v arcsec)...\n",
+		len(dets), radius,
+	)
+
+	pos := make([]lsst.RaDec, len(dets))
+	for i, det := range dets {
+		pos[i] = det.RaDec
+	}
+	groups := lsst.FriendsOfFriends(pos, radius/3600)
+
+	// stable ids, whatever the order of the input files.
+	oids := make(map[int]int64)
+	for i, det := range dets {
+		g := groups[i]
+		if oid, ok := oids[g]; !ok || det.ID < oid {
+			oids[g] = det.ID
+		}
+	}
+
+	// objects are binned at the position of their first detection: the
+	// detections of an object across a cell boundary stay in one cell.
+	for i, det := range dets {
+		f := lsst.File{Run: int(det.Run), Field: int(det.Field)}
+		at := dets[groups[i]].RaDec
+		err = proc.updatelst(at, f, int(det.Fid), det.MJD, det.ID, oids[groups[i]],
+			det.RaDec.Ra, det.RaDec.Dec, det.Flux, det.FluxErr, det.RefFlux,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return proc.reportAmbiguous(dets, groups, oids)
+}
+
+// reportAmbiguous writes the objects with more than one detection in a file,
+// as these merged distinct sources (or a source split in a file.)
+func (proc *listbuilder) reportAmbiguous(dets []detection, groups []int, oids map[int]int64) error {
+	type group struct {
+		n     int            // number of detections
+		ndup  int            // number of detections sharing a file
+		files map[int32]int  // number of detections in each file
+		oids  map[int64]bool // objectIds of the detections
+	}
+
+	var (
+		order []int // groups, in the order of their first detection
+		infos = make(map[int]*group)
+	)
+	for i, det := range dets {
+		g, ok := infos[groups[i]]
+		if !ok {
+			g = &group{
+				files: make(map[int32]int),
+				oids:  make(map[int64]bool),
+			}
+			infos[groups[i]] = g
+			order = append(order, groups[i])
+		}
+		g.n++
+		g.files[det.File]++
+		switch g.files[det.File] {
+		case 1:
+		case 2:
+			g.ndup += 2
+		default:
+			g.ndup++
+		}
+		g.oids[det.OID] = true
+	}
+
+	fname := filepath.Join(proc.OutputDir, "ambiguous.txt")
+	proc.Infof("saving ambiguous associations to [%s]\n", fname)
+	fout, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+
+	fmt.Fprintf(fout, "## oid nmeas ndup noids ra dec\n")
+	for _, i := range order {
+		g := infos[i]
+		if g.ndup == 0 {
+			continue
+		}
+		p := dets[i].RaDec
+		fmt.Fprintf(fout, "%d %d %d %d %v %v\n", oids[i], g.n, g.ndup, len(g.oids), p.Ra, p.Dec)
+		proc.NbAmbiguous += 1
+	}
+	proc.Infof(" #ambiguous: %d\n", proc.NbAmbiguous)
+
+	return fout.Close()
+}
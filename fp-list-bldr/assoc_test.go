@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lsst-france/fp-ana/lsst"
+)
+
+func TestAssociateAcrossCells(t *testing.T) {
+	proc := NewListBuilder("listbuilder").(*listbuilder)
+	proc.OutputDir = t.TempDir()
+	proc.FilterDb = map[int]int{2: 0}
+	proc.Cells = radecBinning{&proc.RaDec}
+	proc.Association = lsst.AssociationOptions{}.WithDefaults()
+
+	// the detections of an object on both sides of the ra=10 cell boundary.
+	dets := []detection{
+		{File: 0, Fid: 0, ID: 12, RaDec: lsst.RaDec{Ra: 10 + 1e-5, Dec: 0.5}, Flux: 10, FluxErr: 1},
+		{File: 1, Fid: 0, ID: 11, RaDec: lsst.RaDec{Ra: 10 - 1e-5, Dec: 0.5}, Flux: 12, FluxErr: 1},
+		{File: 2, Fid: 0, ID: 13, RaDec: lsst.RaDec{Ra: 10 + 2e-5, Dec: 0.5}, Flux: 11, FluxErr: 1},
+	}
+	err := proc.associateDetections(dets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ms []lsst.FPMeasure
+	for _, measures := range proc.Measures {
+		for _, m := range measures {
+			ms = append(ms, m)
+		}
+	}
+	if len(ms) != 1 {
+		t.Fatalf("got %d objects (want=1): %+v", len(ms), ms)
+	}
+	if m := ms[0]; m.OID != 11 || m.Fluxes[0].N != 3 {
+		t.Fatalf("got objectId=%d with %d measurements (want=11, 3)", m.OID, m.Fluxes[0].N)
+	}
+	if proc.NbObjects != 1 {
+		t.Fatalf("got NbObjects=%d (want=1)", proc.NbObjects)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/lsst-france/fp-ana/lsst"
+)
+
+// AstromRecord is a row of the astrometry table: the mean position,
+// positional scatter and proper motion of a source.
+type AstromRecord struct {
+	OID    int64      `fits:"objectId"`
+	ID     int64      `fits:"id"`
+	Coord  [2]float64 `fits:"coord"` // mean ra, dec in degrees
+	N      int64      `fits:"n"`
+	Sigma  [2]float64 `fits:"sigma"` // scatter in ra*cos(dec), dec (arcsec)
+	NEpoch int64      `fits:"nepoch"`
+	Epoch  float64    `fits:"epoch"`  // mean epoch of the proper-motion fit (MJD)
+	PM     [2]float64 `fits:"pm"`     // proper motion in ra*cos(dec), dec (mas/yr)
+	PMErr  [2]float64 `fits:"pm_err"` // proper-motion errors (mas/yr)
+}
+
+func newAstromRecord(m lsst.FPMeasure) AstromRecord {
+	mean := m.Astrom.Mean()
+	sra, sdec := m.Astrom.Sigma()
+	pm := m.Astrom.ProperMotion()
+	return AstromRecord{
+		OID:    m.OID,
+		ID:     m.ID,
+		Coord:  [2]float64{mean.Ra, mean.Dec},
+		N:      int64(m.Astrom.N),
+		Sigma:  [2]float64{sra, sdec},
+		NEpoch: int64(pm.N),
+		Epoch:  pm.Epoch,
+		PM:     [2]float64{pm.Ra, pm.Dec},
+		PMErr:  [2]float64{pm.RaErr, pm.DecErr},
+	}
+}
+
+type astromRecords []AstromRecord
+
+func (p astromRecords) Len() int           { return len(p) }
+func (p astromRecords) Less(i, j int) bool { return p[i].OID < p[j].OID }
+func (p astromRecords) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// writeAstrometry writes the astrometry of the sources, sorted by object id,
+// to the "astrometry" table of the FITS file fname.
+func writeAstrometry(fname string, recs []AstromRecord) error {
+	sort.Sort(astromRecords(recs))
+	return writeTable(fname, "astrometry", AstromRecord{}, len(recs), func(i int) interface{} {
+		return &recs[i]
+	})
+}
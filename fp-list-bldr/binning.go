@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lsst-france/fp-ana/lsst"
+	"github.com/lsst-france/fp-ana/lsst/healpix"
+)
+
+// binning partitions the sky into cells.
+type binning interface {
+	// Index returns the index of the cell holding (ra,dec) and whether
+	// (ra,dec) is inside one of the cells.
+	Index(ra, dec float64) (int, bool)
+
+	// Center returns the center of the cell with index idx.
+	Center(idx int) lsst.RaDec
+
+	// String describes the binning. Checkpoints are only restored
+	// with the same binning.
+	String() string
+}
+
+// radecBinning bins the sky in the ra-dec cells of a region.
+type radecBinning struct {
+	*lsst.RaDecLim
+}
+
+func (b radecBinning) String() string {
+	return fmt.Sprintf("radec: %+v", *b.RaDecLim)
+}
+
+// hpxBinning bins the sky in HEALPix pixels.
+// The cell index is the HEALPix pixel index.
+type hpxBinning struct {
+	hpx *healpix.Healpix
+}
+
+func (b hpxBinning) Index(ra, dec float64) (int, bool) {
+	return int(b.hpx.RaDec2Pix(ra, dec)), true
+}
+
+func (b hpxBinning) Center(idx int) lsst.RaDec {
+	ra, dec := b.hpx.Pix2RaDec(int64(idx))
+	return lsst.RaDec{Ra: ra, Dec: dec}
+}
+
+func (b hpxBinning) String() string {
+	return fmt.Sprintf("healpix: nside=%d scheme=%v", b.hpx.NSide(), b.hpx.Scheme())
+}
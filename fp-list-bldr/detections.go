@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// detectionStore keeps the detections to associate by position.
+//
+// Detections are buffered in memory and appended to a file under Dir, so
+// that a checkpoint only needs to save the size of the file.
+type detectionStore struct {
+	Dir    string // directory of the detections file
+	MaxMem int    // maximum number of detections buffered in memory
+
+	mem  []detection
+	f    *os.File
+	size int64 // number of bytes of the detections file
+}
+
+func newDetectionStore(dir string, maxMem int) *detectionStore {
+	return &detectionStore{
+		Dir:    dir,
+		MaxMem: maxMem,
+	}
+}
+
+func (s *detectionStore) fname() string {
+	return filepath.Join(s.Dir, "detections.bin")
+}
+
+// Len returns the number of detections.
+func (s *detectionStore) Len() int {
+	return int(s.size)/binary.Size(detection{}) + len(s.mem)
+}
+
+// Add adds the detection det.
+func (s *detectionStore) Add(det detection) error {
+	s.mem = append(s.mem, det)
+	if len(s.mem) < s.MaxMem {
+		return nil
+	}
+	return s.Flush()
+}
+
+// open opens the detections file for writing.
+// Data beyond the known size of the file (from a previous job) is discarded.
+func (s *detectionStore) open() (*os.File, error) {
+	if s.f != nil {
+		return s.f, nil
+	}
+
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(s.fname(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Truncate(s.size)
+	if err == nil {
+		_, err = f.Seek(s.size, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.f = f
+	return f, nil
+}
+
+// Flush appends the detections held in memory to the detections file.
+func (s *detectionStore) Flush() error {
+	if len(s.mem) == 0 {
+		return nil
+	}
+
+	f, err := s.open()
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = binary.Write(w, binary.LittleEndian, s.mem)
+	if err != nil {
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	s.size += int64(len(s.mem) * binary.Size(detection{}))
+	s.mem = s.mem[:0]
+	return nil
+}
+
+// Load returns all the detections, in the order they were added.
+func (s *detectionStore) Load() ([]detection, error) {
+	err := s.Flush()
+	if err != nil {
+		return nil, err
+	}
+	if s.size == 0 {
+		return nil, nil
+	}
+
+	f, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, 0, s.size))
+	dets := make([]detection, s.Len())
+	err = binary.Read(r, binary.LittleEndian, dets)
+	if err != nil {
+		return nil, fmt.Errorf("error reading detections from [%s]: %v", s.fname(), err)
+	}
+	return dets, nil
+}
+
+// Checkpoint flushes the detections to the detections file and returns
+// its size.
+func (s *detectionStore) Checkpoint() (int64, error) {
+	err := s.Flush()
+	return s.size, err
+}
+
+// Restore restores the state of the store from the size of the detections
+// file saved at a checkpoint.
+// Detections written after the checkpoint are discarded.
+func (s *detectionStore) Restore(size int64) error {
+	if s.f != nil {
+		return fmt.Errorf("detections file [%s] already open", s.fname())
+	}
+	s.size = size
+	s.mem = nil
+	return nil
+}
+
+// Close closes the detections file.
+// The file is kept on disk, to resume from a checkpoint.
+func (s *detectionStore) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// Remove closes and removes the detections file.
+func (s *detectionStore) Remove() error {
+	err := s.Close()
+	e := os.Remove(s.fname())
+	if e != nil && !os.IsNotExist(e) && err == nil {
+		err = e
+	}
+	return err
+}
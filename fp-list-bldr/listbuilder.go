@@ -1,30 +1,55 @@
 package main
 
 import (
+	"encoding/gob"
 	"fmt"
+	"io"
 	"math"
-	"os"
 	"path/filepath"
+	"sort"
 
-	fits "github.com/astrogo/fitsio"
 	"github.com/lsst-france/fp-ana/lsst"
 )
 
 const (
 	rad2deg = 180.0 / math.Pi
+
+	maxDetections = 1 << 20 // number of detections buffered in memory
 )
 
 type listbuilder struct {
 	*lsst.Processor
 
-	Measures []lsst.FPMeasures
+	Cells    binning                 // binning of the sky
+	Measures map[int]lsst.FPMeasures // measures of each non-empty cell
 	FilterDb map[int]int
 	Filters  []int
 
+	Sources *lsst.SourceReader
+
+	Robust      lsst.RobustOptions
+	Variability lsst.VariabilityOptions
+	Selection   lsst.SelectionOptions
+	selector    *lsst.Selector
+	Astrometry  bool
+	CSV         bool              // also write the list of sources as CSV
+	Epochs      *lsst.Epochs      // epoch of the measurements, for variability indices and proper motions
+	samples     *lsst.SampleStore // individual measurements, for robust statistics and variability
+
+	Mags lsst.MagOptions
+	zps  []float64 // magnitude zero point of each filter
+
+	Association lsst.AssociationOptions
+	assoc       lsst.AssocMode
+	detections  *detectionStore // measurements to associate by position
+
 	NbObjects     int
 	NbMeasures    int
 	NbBadMeasures int
 	NbMeasuresIn  int
+	NbNoEpoch     int // number of files without a known epoch
+	NbFiles       int // number of merged files
+	NbAmbiguous   int // number of ambiguous objects, with position association
 
 	//NbErrOID   int
 	NbErrRaDec int
@@ -33,14 +58,20 @@ type listbuilder struct {
 func NewListBuilder(name string) lsst.P {
 	ctx := &listbuilder{
 		Processor: lsst.NewProcessor(name),
+		Measures:  make(map[int]lsst.FPMeasures),
 		FilterDb:  make(map[int]int),
 		Filters:   []int{},
+		Sources:   lsst.NewSourceReader(""),
+
+		Association: lsst.AssociationOptions{}.WithDefaults(),
 	}
 
 	ctx.Config = ctx.config
 	ctx.Start = ctx.start
-	ctx.Proc = ctx.proc
+	ctx.Map = ctx.read
+	ctx.Reduce = ctx.merge
 	ctx.Stop = ctx.stop
+	ctx.Checkpointer = ctx
 
 	return ctx
 }
@@ -52,14 +83,114 @@ func (proc *listbuilder) config(opts lsst.Options) error {
 		return err
 	}
 
-	for _, sfilter := range cfg.Filters {
-		filter := byte(sfilter[0])
-		proc.Filters = append(proc.Filters, lsst.FilterID(filter))
+	// collect the job filters and the filters of each run
+	filters := append([]string{}, cfg.Filters...)
+	for _, r := range cfg.RunFMMs {
+		filters = append(filters, r.Filters...)
+	}
+
+	seen := make(map[int]bool)
+	for _, sfilter := range filters {
+		b, err := proc.FilterSet.Parse(sfilter)
+		if err != nil {
+			return err
+		}
+		filter, _ := proc.FilterSet.ID(b)
+		if seen[filter] {
+			continue
+		}
+		seen[filter] = true
+		proc.Filters = append(proc.Filters, filter)
+	}
+
+	proc.Sources = lsst.NewSourceReader(cfg.FluxErr)
+
+	proc.Robust = cfg.Robust.WithDefaults()
+	proc.Variability = cfg.Variability.WithDefaults()
+	proc.Selection = cfg.Selection
+	proc.Astrometry = cfg.Astrometry
+	proc.CSV = cfg.CSV
+	if proc.needEpochs() {
+		proc.Epochs, err = lsst.NewEpochs(cfg.Epoch)
+		if err != nil {
+			return err
+		}
+	}
+
+	proc.Mags = cfg.Mags
+	if proc.Mags.FluxMag0Key == "" {
+		proc.Mags.FluxMag0Key = lsst.DefaultFluxMag0Key
+	}
+	if proc.Mags.Enable {
+		err = proc.configMags()
+		if err != nil {
+			return err
+		}
+		if proc.Mags.FluxMag0 && cfg.Flux == [2]float64{} {
+			// the default Flux window is in file units, not in nJy.
+			return fmt.Errorf("Mags.FluxMag0 needs a Flux window in nJy")
+		}
+	}
+
+	if proc.Selection.NeedMags() && !proc.Mags.Enable {
+		return fmt.Errorf("magnitude and color cuts need Mags.Enable")
+	}
+
+	proc.Association = cfg.Association.WithDefaults()
+	proc.assoc, err = lsst.ParseAssocMode(proc.Association.Mode)
+	if err != nil {
+		return err
+	}
+
+	proc.Cells = radecBinning{&proc.RaDec}
+	hpx, err := cfg.Healpix.New()
+	if err != nil {
+		return err
+	}
+	if hpx != nil {
+		proc.Cells = hpxBinning{hpx: hpx}
 	}
 
 	return err
 }
 
+// configMags sets up the zero point of each filter.
+func (proc *listbuilder) configMags() error {
+	proc.zps = make([]float64, len(proc.Filters))
+	if proc.Mags.FluxMag0 {
+		// fluxes are calibrated to nJy when read.
+		for i := range proc.zps {
+			proc.zps[i] = lsst.ABZeroPoint
+		}
+		return nil
+	}
+
+	zps := make(map[int]float64, len(proc.Mags.ZeroPoints))
+	for name, zp := range proc.Mags.ZeroPoints {
+		b, err := proc.FilterSet.Parse(name)
+		if err != nil {
+			return err
+		}
+		id, _ := proc.FilterSet.ID(b)
+		zps[id] = zp
+	}
+
+	for i, filter := range proc.Filters {
+		zp, ok := zps[filter]
+		if !ok {
+			b, _ := proc.FilterSet.Filter(filter)
+			return fmt.Errorf("no magnitude zero point for filter %q", string(b))
+		}
+		proc.zps[i] = zp
+	}
+	return nil
+}
+
+// needEpochs returns whether the epoch of the input files is needed.
+func (proc *listbuilder) needEpochs() bool {
+	return proc.Variability.Enable || proc.Astrometry
+}
+
 func (proc *listbuilder) start() error {
 	var err error
 
@@ -71,82 +202,177 @@ func (proc *listbuilder) start() error {
 		proc.FilterDb[filter] = i
 	}
 
-	for i := 0; i < proc.RaDec.NbRa*proc.RaDec.NbDec; i++ {
-		proc.Measures = append(proc.Measures, make(lsst.FPMeasures))
+	if proc.Cells == nil {
+		proc.Cells = radecBinning{&proc.RaDec}
+	}
+
+	proc.selector, err = lsst.NewSelector(proc.Selection, proc.Flux, proc.FilterSet, proc.Filters)
+	if err != nil {
+		return err
+	}
+
+	if proc.needEpochs() && proc.Epochs == nil {
+		proc.Epochs, err = lsst.NewEpochs(lsst.EpochOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	if proc.Robust.Enable || proc.Variability.Enable {
+		proc.samples = lsst.NewSampleStore(
+			filepath.Join(proc.OutputDir, "samples"),
+			proc.Robust.MaxSamples,
+			proc.Robust.Partitions,
+		)
+	}
+
+	if proc.assoc == lsst.AssocPosition {
+		proc.detections = newDetectionStore(proc.OutputDir, maxDetections)
 	}
 
 	proc.Infof("filter-db: %v\n", proc.FilterDb)
-	proc.Infof("measures:  %d\n", len(proc.Measures))
 	proc.Infof("nfilters:  %d\n", len(proc.Filters))
-	proc.Infof("radec:     %#v\n", proc.RaDec)
+	proc.Infof("cells:     %v\n", proc.Cells)
+	if proc.assoc == lsst.AssocPosition {
+		proc.Infof("association by position (match radius: %v arcsec)\n", proc.Association.MatchRadius)
+	}
 
 	return err
 }
 
-func (proc *listbuilder) proc(f lsst.File) error {
+// fpfile holds the rows of a forced-photometry file.
+type fpfile struct {
+	fid  int
+	mjd  float64 // epoch of the file (0: unknown)
+	rows []lsst.Source
+}
+
+// read reads all the rows of a forced-photometry file.
+// read is run concurrently on multiple files.
+func (proc *listbuilder) read(f lsst.File) (interface{}, error) {
 	var err error
 	//proc.Infof(">>> file=%#v\n", f)
 
-	fid, ok := proc.FilterDb[lsst.FilterID(f.Filter)]
+	id, err := proc.FilterSet.ID(f.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	fid, ok := proc.FilterDb[id]
 	if !ok {
 		proc.Errorf("filter-id for [%s] not found in filter-db\n", string(f.Filter))
-		return err
+		return nil, err
 	}
 	proc.Infof("filter-id: %d (%s)\n", fid, string(f.Filter))
 
-	rr, err := os.Open(f.Name)
+	ff, err := lsst.OpenFITS(f.Name)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer rr.Close()
+	defer ff.Close()
 
-	ff, err := fits.Open(rr)
+	table, err := ff.Table()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer ff.Close()
-
-	table := ff.HDU(1).(*fits.Table)
 	nrows := table.NumRows()
 
 	if nrows < 1 {
 		proc.Errorf("file run=%d field=%d camcol=%d filter=%s == nrows=0\n",
-			f.Run, f.Field, f.CamCol, f.Filter,
+			f.Run, f.Field, f.CamCol, string(f.Filter),
 		)
-		return fmt.Errorf("no data")
+		return nil, fmt.Errorf("no data")
 	}
 
-	rows, err := table.Read(0, nrows)
+	data := fpfile{fid: fid}
+	if !proc.Sources.HasFluxErr(table) {
+		proc.Warnf("no flux error column %q in [%s]: weighted statistics skipped\n",
+			proc.Sources.FluxErr, f.Name,
+		)
+	}
+	data.rows, err = proc.Sources.Read(table)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer rows.Close()
-	for rows.Next() {
 
-		data := struct {
-			ID      int64      `fits:"id"`
-			OID     int64      `fits:"objectId"`
-			Flux    float64    `fits:"flux_psf"`
-			RefFlux float64    `fits:"refFlux"`
-			Coord   [2]float64 `fits:"coord"`
-		}{}
+	if proc.needEpochs() {
+		// measurements without a known epoch (0) do not enter the von Neumann
+		// ratio nor proper motions.
+		data.mjd, err = proc.Epochs.MJD(f, ff)
+		if err != nil {
+			proc.Debugf("%v\n", err)
+			data.mjd = 0
+			err = nil
+		}
+	}
 
-		err = rows.Scan(&data)
+	if proc.Mags.Enable && proc.Mags.FluxMag0 {
+		fluxMag0, err := ff.Float(proc.Mags.FluxMag0Key)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		// calibrate fluxes to AB nJy
+		scale := lsst.NJyScale(lsst.FluxMag0ToZeroPoint(fluxMag0))
+		for i := range data.rows {
+			data.rows[i].Flux *= scale
+			data.rows[i].FluxErr *= scale
 		}
+	}
+
+	return data, err
+}
+
+// merge accumulates the rows of a file into the list of sources.
+// merge is called sequentially, in the order of the input files.
+func (proc *listbuilder) merge(f lsst.File, v interface{}) error {
+	var err error
+	if v == nil {
+		// filter not selected
+		return err
+	}
 
-		//fmt.Printf(">>> %v\n", data)
+	data := v.(fpfile)
+	if proc.needEpochs() && data.mjd == 0 {
+		proc.NbNoEpoch += 1
+	}
 
-		id := data.ID
-		oid := data.OID
-		flx := data.Flux
-		refflx := data.RefFlux
+	if proc.assoc == lsst.AssocPosition {
+		// objects are only known once all the measurements are in.
+		for _, row := range data.rows {
+			err = proc.detections.Add(detection{
+				File:    int32(proc.NbFiles),
+				Run:     int32(f.Run),
+				Field:   int32(f.Field),
+				Fid:     int32(data.fid),
+				MJD:     data.mjd,
+				ID:      row.ID,
+				OID:     row.OID,
+				RaDec:   row.RaDec(),
+				Flux:    row.Flux,
+				FluxErr: row.FluxErr,
+				RefFlux: row.RefFlux,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		proc.NbFiles += 1
+		return err
+	}
+	proc.NbFiles += 1
+
+	for _, row := range data.rows {
+		id := row.ID
+		oid := row.OID
+		flx := row.Flux
+		flxerr := row.FluxErr
+		refflx := row.RefFlux
 		// convert radians to degrees
-		ra := data.Coord[0] * rad2deg
-		dec := data.Coord[1] * rad2deg
+		ra := row.Coord[0] * rad2deg
+		dec := row.Coord[1] * rad2deg
 
-		err = proc.updatelst(fid, id, oid, ra, dec, flx, refflx)
+		at := lsst.RaDec{Ra: ra, Dec: dec}
+		err = proc.updatelst(at, f, data.fid, data.mjd, id, oid, ra, dec, flx, flxerr, refflx)
 		if err != nil {
 			return err
 		}
@@ -155,7 +381,10 @@ func (proc *listbuilder) proc(f lsst.File) error {
 	return err
 }
 
-func (proc *listbuilder) updatelst(fid int, id, oid int64, ra, dec, flx, refflx float64) error {
+// updatelst adds a measurement at (ra, dec) to the object oid.
+// The object is selected and binned at the position at, so that all the
+// measurements of an object end up in the same cell.
+func (proc *listbuilder) updatelst(at lsst.RaDec, f lsst.File, fid int, mjd float64, id, oid int64, ra, dec, flx, flxerr, refflx float64) error {
 	var err error
 	proc.NbMeasures += 1
 
@@ -166,19 +395,24 @@ func (proc *listbuilder) updatelst(fid int, id, oid int64, ra, dec, flx, refflx
 		return err
 	}
 
-	kdec := int((dec - proc.RaDec.Min.Dec) / float64(proc.RaDec.DeltaDec))
-	kra := int((ra - proc.RaDec.Min.Ra) / float64(proc.RaDec.DeltaRa))
+	// check whether we are indeed in the selected region
+	if !proc.Region.Contains(at) {
+		return err
+	}
 
-	// check whether we are indeed in the alpha/delta selected zone
-	if kra < 0 || kdec < 0 || kra >= proc.RaDec.NbRa || kdec >= proc.RaDec.NbDec {
+	idx, ok := proc.Cells.Index(at.Ra, at.Dec)
+	if !ok {
 		return err
 	}
 
 	proc.NbMeasuresIn += 1
 
-	rdidx := kdec*proc.RaDec.NbRa + kra
-	measures := &proc.Measures[rdidx]
-	measure, ok := (*measures)[oid]
+	measures, ok := proc.Measures[idx]
+	if !ok {
+		measures = make(lsst.FPMeasures)
+		proc.Measures[idx] = measures
+	}
+	measure, ok := measures[oid]
 	if !ok {
 		// adding a new source / object
 		measure = lsst.FPMeasure{
@@ -187,61 +421,323 @@ func (proc *listbuilder) updatelst(fid int, id, oid int64, ra, dec, flx, refflx
 			RaDec:  lsst.RaDec{Ra: ra, Dec: dec},
 			Fluxes: make([]lsst.FluxRec, len(proc.FilterDb)),
 		}
-		measure.Add(fid, flx)
+		measure.AddErr(fid, flx, flxerr)
+		measure.Astrom.Add(lsst.RaDec{Ra: ra, Dec: dec}, mjd)
 		proc.NbObjects += 1
 	} else {
 		const delta = 2. / 3600.
-		if math.Abs(measure.RaDec.Ra-ra) > delta ||
+		if math.Abs(lsst.RaDiff(measure.RaDec.Ra, ra)) > delta ||
 			math.Abs(measure.RaDec.Dec-dec) > delta {
 			proc.NbErrRaDec += 1
 		}
-		measure.Add(fid, flx)
+		measure.AddErr(fid, flx, flxerr)
+		measure.Astrom.Add(lsst.RaDec{Ra: ra, Dec: dec}, mjd)
+	}
+	measures[oid] = measure
+
+	if proc.samples != nil {
+		err = proc.samples.Add(oid, fid, lsst.Sample{
+			Flux:    flx,
+			FluxErr: flxerr,
+			MJD:     mjd,
+			RaDec:   lsst.RaDec{Ra: ra, Dec: dec},
+			Run:     int32(f.Run),
+			Field:   int32(f.Field),
+		})
 	}
-	(*measures)[oid] = measure
 
 	return err
 }
 
+// lbState is the state of a listbuilder saved in checkpoints.
+type lbState struct {
+	Cells    string
+	Measures map[int]lsst.FPMeasures
+	Samples  []int64 // sizes of the sample files, with robust statistics or variability
+
+	Detections int64 // size of the detections file, with position association
+
+	NbObjects     int
+	NbMeasures    int
+	NbBadMeasures int
+	NbMeasuresIn  int
+	NbNoEpoch     int
+	NbFiles       int
+	NbErrRaDec    int
+}
+
+// Checkpoint implements lsst.Checkpointer
+func (proc *listbuilder) Checkpoint(w io.Writer) error {
+	var (
+		err        error
+		samples    []int64
+		detections int64
+	)
+	if proc.samples != nil {
+		samples, err = proc.samples.Checkpoint()
+		if err != nil {
+			return err
+		}
+	}
+	if proc.detections != nil {
+		detections, err = proc.detections.Checkpoint()
+		if err != nil {
+			return err
+		}
+	}
+
+	return gob.NewEncoder(w).Encode(lbState{
+		Cells:         proc.Cells.String(),
+		Measures:      proc.Measures,
+		Samples:       samples,
+		Detections:    detections,
+		NbObjects:     proc.NbObjects,
+		NbMeasures:    proc.NbMeasures,
+		NbBadMeasures: proc.NbBadMeasures,
+		NbMeasuresIn:  proc.NbMeasuresIn,
+		NbNoEpoch:     proc.NbNoEpoch,
+		NbFiles:       proc.NbFiles,
+		NbErrRaDec:    proc.NbErrRaDec,
+	})
+}
+
+// Restore implements lsst.Checkpointer
+func (proc *listbuilder) Restore(r io.Reader) error {
+	var state lbState
+	err := gob.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return err
+	}
+
+	if cells := proc.Cells.String(); state.Cells != cells {
+		return fmt.Errorf("checkpoint has cells [%s] (want=[%s])",
+			state.Cells, cells,
+		)
+	}
+
+	if proc.samples != nil {
+		err = proc.samples.Restore(state.Samples)
+		if err != nil {
+			return err
+		}
+	}
+
+	if proc.detections != nil {
+		err = proc.detections.Restore(state.Detections)
+		if err != nil {
+			return err
+		}
+	}
+
+	proc.Measures = state.Measures
+	proc.NbObjects = state.NbObjects
+	proc.NbMeasures = state.NbMeasures
+	proc.NbBadMeasures = state.NbBadMeasures
+	proc.NbMeasuresIn = state.NbMeasuresIn
+	proc.NbNoEpoch = state.NbNoEpoch
+	proc.NbFiles = state.NbFiles
+	proc.NbErrRaDec = state.NbErrRaDec
+	return err
+}
+
 func (proc *listbuilder) stop() error {
 	var err error
+	if proc.assoc == lsst.AssocPosition {
+		err = proc.associate()
+		if err != nil {
+			return err
+		}
+	}
+
 	proc.Infof("--- list-builder stats ---\n")
 	proc.Infof(" #measures:  %d\n", proc.NbMeasures)
 	proc.Infof(" #bad-meas:  %d\n", proc.NbBadMeasures)
 	proc.Infof(" #meas-in:   %d\n", proc.NbMeasuresIn)
 	proc.Infof(" #objects:   %d\n", proc.NbObjects)
 	proc.Infof(" #err-radec: %d\n", proc.NbErrRaDec)
+	if proc.needEpochs() {
+		proc.Infof(" #no-epoch:  %d files\n", proc.NbNoEpoch)
+	}
 
-	fname := filepath.Join(proc.OutputDir, "srclist.txt")
+	if proc.samples != nil {
+		err = proc.sampleStats()
+		if err != nil {
+			return err
+		}
+	}
+
+	cols := proc.srcColumns()
+	fname := filepath.Join(proc.OutputDir, "srclist.fits")
 	proc.Infof("saving object/source list to [%s]\n", fname)
-	fout, err := os.Create(fname)
+	fsw, err := newFitsSrcWriter(fname, cols)
 	if err != nil {
 		return err
 	}
-	defer fout.Close()
+	writers := []srcWriter{fsw}
+	defer func() {
+		for _, sw := range writers {
+			sw.Close()
+		}
+	}()
+
+	if proc.CSV {
+		fname := filepath.Join(proc.OutputDir, "srclist.csv")
+		proc.Infof("saving object/source list to [%s]\n", fname)
+		csw, err := newCSVSrcWriter(fname, cols)
+		if err != nil {
+			return err
+		}
+		writers = append(writers, csw)
+	}
+
+	var (
+		vars   []VarCandidate // variable candidates
+		astrom []AstromRecord // astrometry of the written sources
+	)
 
 	nsrc := 0
-	fmt.Fprintf(fout, "## id oid ra dec flx-mean-1 flx-sigma-1 nmes-1 flx-mean-2 ...\n")
+	cells := make([]int, 0, len(proc.Measures))
+	for i := range proc.Measures {
+		cells = append(cells, i)
+	}
+	sort.Ints(cells)
+
 	// loop over cells in alpha/delta
-	for i, measures := range proc.Measures {
-		//measures := &proc.Measures[idx]
-		proc.Debugf(" ra-dec-cell[%03d] ra,dec=(%+8.3f, %+8.3f) => #srcs=%d\n",
+	for _, i := range cells {
+		measures := proc.Measures[i]
+		center := proc.Cells.Center(i)
+		proc.Debugf(" cell[%03d] ra,dec=(%+8.3f, %+8.3f) => #srcs=%d\n",
 			i,
-			proc.RaDec.Min.Ra+proc.RaDec.DeltaRa*(float64(i%proc.RaDec.NbRa)+0.5),
-			proc.RaDec.Min.Dec+proc.RaDec.DeltaDec*(float64(i%proc.RaDec.NbDec)+0.5),
+			center.Ra,
+			center.Dec,
 			len(measures),
 		)
+		oids := make([]int64, 0, len(measures))
+		for oid := range measures {
+			oids = append(oids, oid)
+		}
+		sort.Sort(int64s(oids))
+
 		// loop over sources of each cell
-		for _, m := range measures {
-			m.ComputeMean()
-			mean := m.Fluxes[0].SumMean
-			if mean < proc.Flux[0] || mean > proc.Flux[1] {
+		for _, oid := range oids {
+			m := measures[oid]
+			if proc.Mags.Enable {
+				m.Mags = make([]lsst.Magnitude, len(m.Fluxes))
+				for i, flx := range m.Fluxes {
+					m.Mags[i] = flx.Mag(proc.zps[i])
+				}
+			}
+			if !proc.selector.Select(m) {
 				continue
 			}
-			fmt.Fprintf(fout, "%#v\n", m)
+			for _, sw := range writers {
+				err = sw.Write(i, &m)
+				if err != nil {
+					return err
+				}
+			}
 			nsrc += 1
+
+			if proc.Astrometry {
+				astrom = append(astrom, newAstromRecord(m))
+			}
+
+			for fid, v := range m.Var {
+				if proc.Variability.Select(v) {
+					vars = append(vars, proc.newVarCandidate(m, fid))
+				}
+			}
 		}
 	}
 	proc.Infof(" #src written: %d/%d\n", nsrc, proc.NbObjects)
 
+	// close every writer once, keeping the first error.
+	for _, sw := range writers {
+		if e := sw.Close(); err == nil {
+			err = e
+		}
+	}
+	writers = nil
+	if err != nil {
+		return err
+	}
+
+	if proc.Variability.Enable {
+		fname := filepath.Join(proc.OutputDir, "variables.fits")
+		proc.Infof("saving variable candidates to [%s]\n", fname)
+		err = writeVariables(fname, vars)
+		if err != nil {
+			return err
+		}
+		proc.Infof(" #variables: %d\n", len(vars))
+	}
+
+	if proc.Astrometry {
+		fname := filepath.Join(proc.OutputDir, "astrometry.fits")
+		proc.Infof("saving astrometry to [%s]\n", fname)
+		err = writeAstrometry(fname, astrom)
+		if err != nil {
+			return err
+		}
+	}
+
 	return err
 }
+
+// sampleStats computes the outlier-resistant statistics and the variability
+// indices of the fluxes of each source, from its individual measurements.
+func (proc *listbuilder) sampleStats() error {
+	cells := make(map[int64]int, proc.NbObjects) // cell of each source
+	for i, measures := range proc.Measures {
+		for oid := range measures {
+			cells[oid] = i
+		}
+	}
+
+	var fluxes []float64
+	err := proc.samples.Each(func(oid int64, fid int, samples []lsst.Sample) error {
+		i, ok := cells[oid]
+		if !ok {
+			return fmt.Errorf("no source for the measurements of oid=%d", oid)
+		}
+
+		fluxes = fluxes[:0]
+		for _, v := range samples {
+			fluxes = append(fluxes, v.Flux)
+		}
+
+		m := proc.Measures[i][oid]
+		if proc.Robust.Enable {
+			if m.Robust == nil {
+				m.Robust = make([]lsst.RobustStats, len(m.Fluxes))
+			}
+			m.Robust[fid] = lsst.NewRobustStats(fluxes, proc.Robust.NSigma, proc.Robust.MaxIter)
+		}
+		if proc.Variability.Enable {
+			if m.Var == nil {
+				m.Var = make([]lsst.Variability, len(m.Fluxes))
+			}
+			m.Var[fid] = lsst.NewVariability(samples)
+		}
+		proc.Measures[i][oid] = m
+		return nil
+	})
+
+	// keep the measurements of an incomplete job, for a later -resume.
+	var e error
+	if proc.Complete() || proc.CheckpointEvery == 0 {
+		e = proc.samples.Remove()
+	} else {
+		e = proc.samples.Close()
+	}
+	if err == nil {
+		err = e
+	}
+	return err
+}
+
+type int64s []int64
+
+func (p int64s) Len() int           { return len(p) }
+func (p int64s) Less(i, j int) bool { return p[i] < p[j] }
+func (p int64s) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+
+	fits "github.com/astrogo/fitsio"
+	"github.com/lsst-france/fp-ana/lsst"
+)
+
+// srcColumn is a column of the list of sources.
+type srcColumn struct {
+	name  string
+	typ   reflect.Type // int64 or float64
+	value func(cell int, m *lsst.FPMeasure) interface{}
+}
+
+var (
+	int64Type   = reflect.TypeOf(int64(0))
+	float64Type = reflect.TypeOf(float64(0))
+)
+
+func i64col(name string, f func(cell int, m *lsst.FPMeasure) int64) srcColumn {
+	return srcColumn{
+		name:  name,
+		typ:   int64Type,
+		value: func(cell int, m *lsst.FPMeasure) interface{} { return f(cell, m) },
+	}
+}
+
+func f64col(name string, f func(cell int, m *lsst.FPMeasure) float64) srcColumn {
+	return srcColumn{
+		name:  name,
+		typ:   float64Type,
+		value: func(cell int, m *lsst.FPMeasure) interface{} { return f(cell, m) },
+	}
+}
+
+// srcColumns returns the columns of the list of sources: the cell index,
+// the object id, the source id and the position of each source, then the
+// statistics of its fluxes in each filter, in columns prefixed with the
+// filter name.
+func (proc *listbuilder) srcColumns() []srcColumn {
+	cols := []srcColumn{
+		i64col("cell", func(cell int, m *lsst.FPMeasure) int64 { return int64(cell) }),
+		i64col("objectId", func(cell int, m *lsst.FPMeasure) int64 { return m.OID }),
+		i64col("id", func(cell int, m *lsst.FPMeasure) int64 { return m.ID }),
+		f64col("ra", func(cell int, m *lsst.FPMeasure) float64 { return m.RaDec.Ra }),
+		f64col("dec", func(cell int, m *lsst.FPMeasure) float64 { return m.RaDec.Dec }),
+	}
+
+	for i, filter := range proc.Filters {
+		i := i
+		b, _ := proc.FilterSet.Filter(filter)
+		name := func(s string) string { return string(b) + "_" + s }
+		flux := func(m *lsst.FPMeasure) lsst.FluxRec { return m.Fluxes[i] }
+
+		cols = append(cols,
+			i64col(name("n"), func(_ int, m *lsst.FPMeasure) int64 { return int64(flux(m).N) }),
+			f64col(name("mean"), func(_ int, m *lsst.FPMeasure) float64 { return flux(m).Mean() }),
+			f64col(name("sigma"), func(_ int, m *lsst.FPMeasure) float64 { return flux(m).StdDev() }),
+			f64col(name("wmean"), func(_ int, m *lsst.FPMeasure) float64 { return flux(m).WMean() }),
+			f64col(name("wmean_err"), func(_ int, m *lsst.FPMeasure) float64 { return flux(m).WMeanErr() }),
+			f64col(name("red_chi2"), func(_ int, m *lsst.FPMeasure) float64 { return flux(m).RedChi2() }),
+		)
+
+		if proc.Mags.Enable {
+			mag := func(m *lsst.FPMeasure) lsst.Magnitude { return m.Mags[i] }
+			cols = append(cols,
+				f64col(name("mag"), func(_ int, m *lsst.FPMeasure) float64 { return mag(m).Mag }),
+				f64col(name("mag_err"), func(_ int, m *lsst.FPMeasure) float64 { return mag(m).MagErr }),
+			)
+		}
+
+		if proc.Robust.Enable {
+			robust := func(m *lsst.FPMeasure) lsst.RobustStats {
+				if i >= len(m.Robust) {
+					return lsst.RobustStats{}
+				}
+				return m.Robust[i]
+			}
+			cols = append(cols,
+				f64col(name("median"), func(_ int, m *lsst.FPMeasure) float64 { return robust(m).Median }),
+				f64col(name("mad_sigma"), func(_ int, m *lsst.FPMeasure) float64 { return robust(m).Sigma }),
+				f64col(name("clip_mean"), func(_ int, m *lsst.FPMeasure) float64 { return robust(m).ClipMean }),
+				f64col(name("clip_sigma"), func(_ int, m *lsst.FPMeasure) float64 { return robust(m).ClipSigma }),
+				i64col(name("nclip"), func(_ int, m *lsst.FPMeasure) int64 { return int64(robust(m).NClip) }),
+			)
+		}
+
+		if proc.Variability.Enable {
+			vari := func(m *lsst.FPMeasure) lsst.Variability {
+				if i >= len(m.Var) {
+					return lsst.Variability{}
+				}
+				return m.Var[i]
+			}
+			cols = append(cols,
+				i64col(name("var_n"), func(_ int, m *lsst.FPMeasure) int64 { return int64(vari(m).N) }),
+				f64col(name("var_red_chi2"), func(_ int, m *lsst.FPMeasure) float64 { return vari(m).RedChi2() }),
+				f64col(name("excess_var"), func(_ int, m *lsst.FPMeasure) float64 { return vari(m).ExcessVar }),
+				f64col(name("stetson_j"), func(_ int, m *lsst.FPMeasure) float64 { return vari(m).StetsonJ }),
+				f64col(name("stetson_k"), func(_ int, m *lsst.FPMeasure) float64 { return vari(m).StetsonK }),
+				f64col(name("eta"), func(_ int, m *lsst.FPMeasure) float64 { return vari(m).Eta }),
+				f64col(name("amplitude"), func(_ int, m *lsst.FPMeasure) float64 { return vari(m).Amplitude }),
+			)
+		}
+	}
+
+	return cols
+}
+
+// srcWriter writes the list of sources.
+type srcWriter interface {
+	Write(cell int, m *lsst.FPMeasure) error
+	Close() error
+}
+
+// fitsSrcWriter writes the list of sources to a FITS binary table, with one
+// row per source.
+type fitsSrcWriter struct {
+	w    *os.File
+	fout *fits.File
+	tbl  *fits.Table
+	cols []srcColumn
+	row  reflect.Value // pointer to the struct of the current row
+}
+
+func newFitsSrcWriter(fname string, cols []srcColumn) (*fitsSrcWriter, error) {
+	fields := make([]reflect.StructField, len(cols))
+	for i, col := range cols {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Col%d", i),
+			Type: col.typ,
+			Tag:  reflect.StructTag(fmt.Sprintf("fits:%q", col.name)),
+		}
+	}
+	row := reflect.New(reflect.StructOf(fields))
+
+	w, err := os.Create(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	sw, err := func() (*fitsSrcWriter, error) {
+		fout, err := fits.Create(w)
+		if err != nil {
+			return nil, err
+		}
+
+		phdu, err := fits.NewPrimaryHDU(nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating PHDU: %v", err)
+		}
+		err = fout.Write(phdu)
+		if err != nil {
+			return nil, err
+		}
+		err = phdu.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		tbl, err := fits.NewTableFrom("srclist", row.Elem().Interface(), fits.BINARY_TBL)
+		if err != nil {
+			return nil, err
+		}
+
+		return &fitsSrcWriter{w: w, fout: fout, tbl: tbl, cols: cols, row: row}, nil
+	}()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return sw, err
+}
+
+func (sw *fitsSrcWriter) Write(cell int, m *lsst.FPMeasure) error {
+	row := sw.row.Elem()
+	for i, col := range sw.cols {
+		row.Field(i).Set(reflect.ValueOf(col.value(cell, m)))
+	}
+	return sw.tbl.Write(sw.row.Interface())
+}
+
+// Close writes the table and closes the file, returning the first error.
+func (sw *fitsSrcWriter) Close() error {
+	errs := []error{
+		sw.fout.Write(sw.tbl),
+		sw.tbl.Close(),
+		sw.fout.Close(),
+		sw.w.Close(),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvSrcWriter writes the list of sources to a CSV file, with a header line
+// holding the names of the columns and one line per source.
+type csvSrcWriter struct {
+	f    *os.File
+	w    *csv.Writer
+	cols []srcColumn
+	rec  []string
+}
+
+func newCSVSrcWriter(fname string, cols []srcColumn) (*csvSrcWriter, error) {
+	f, err := os.Create(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &csvSrcWriter{
+		f:    f,
+		w:    csv.NewWriter(f),
+		cols: cols,
+		rec:  make([]string, len(cols)),
+	}
+	for i, col := range cols {
+		sw.rec[i] = col.name
+	}
+	err = sw.w.Write(sw.rec)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return sw, err
+}
+
+func (sw *csvSrcWriter) Write(cell int, m *lsst.FPMeasure) error {
+	for i, col := range sw.cols {
+		switch v := col.value(cell, m).(type) {
+		case int64:
+			sw.rec[i] = strconv.FormatInt(v, 10)
+		case float64:
+			sw.rec[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return sw.w.Write(sw.rec)
+}
+
+// Close flushes the CSV records and closes the file, returning the first error.
+func (sw *csvSrcWriter) Close() error {
+	sw.w.Flush()
+	err := sw.w.Error()
+	if e := sw.f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	fits "github.com/astrogo/fitsio"
+)
+
+// writeTable writes the FITS file fname with a primary HDU and a binary table
+// name, with the columns of the struct rowType and the n rows returned by row.
+func writeTable(fname, name string, rowType interface{}, n int, row func(i int) interface{}) error {
+	w, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	fout, err := fits.Create(w)
+	if err != nil {
+		return err
+	}
+
+	phdu, err := fits.NewPrimaryHDU(nil)
+	if err != nil {
+		return fmt.Errorf("error creating PHDU: %v", err)
+	}
+	err = fout.Write(phdu)
+	if err != nil {
+		return err
+	}
+	err = phdu.Close()
+	if err != nil {
+		return err
+	}
+
+	tbl, err := fits.NewTableFrom(name, rowType, fits.BINARY_TBL)
+	if err != nil {
+		return err
+	}
+	defer tbl.Close()
+
+	for i := 0; i < n; i++ {
+		err = tbl.Write(row(i))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = fout.Write(tbl)
+	if err != nil {
+		return err
+	}
+
+	return fout.Close()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/lsst-france/fp-ana/lsst"
+)
+
+// VarCandidate is a row of the table of variable candidates: the variability
+// indices of the fluxes of a source in a filter.
+type VarCandidate struct {
+	OID       int64      `fits:"objectId"`
+	ID        int64      `fits:"id"`
+	Filter    int32      `fits:"filter"` // filter index in the filter set
+	Coord     [2]float64 `fits:"coord"`  // ra, dec in degrees
+	N         int64      `fits:"n"`
+	WMean     float64    `fits:"wmean"`
+	RedChi2   float64    `fits:"red_chi2"`
+	ExcessVar float64    `fits:"excess_var"`
+	StetsonJ  float64    `fits:"stetson_j"`
+	StetsonK  float64    `fits:"stetson_k"`
+	Eta       float64    `fits:"eta"`
+	Amplitude float64    `fits:"amplitude"`
+}
+
+func (proc *listbuilder) newVarCandidate(m lsst.FPMeasure, fid int) VarCandidate {
+	v := m.Var[fid]
+	return VarCandidate{
+		OID:       m.OID,
+		ID:        m.ID,
+		Filter:    int32(proc.Filters[fid]),
+		Coord:     [2]float64{m.RaDec.Ra, m.RaDec.Dec},
+		N:         int64(v.N),
+		WMean:     v.WMean,
+		RedChi2:   v.RedChi2(),
+		ExcessVar: v.ExcessVar,
+		StetsonJ:  v.StetsonJ,
+		StetsonK:  v.StetsonK,
+		Eta:       v.Eta,
+		Amplitude: v.Amplitude,
+	}
+}
+
+type varCandidates []VarCandidate
+
+func (p varCandidates) Len() int      { return len(p) }
+func (p varCandidates) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p varCandidates) Less(i, j int) bool {
+	if p[i].OID != p[j].OID {
+		return p[i].OID < p[j].OID
+	}
+	return p[i].Filter < p[j].Filter
+}
+
+// writeVariables writes the variable candidates, sorted by object id,
+// to the "variables" table of the FITS file fname.
+func writeVariables(fname string, vars []VarCandidate) error {
+	sort.Sort(varCandidates(vars))
+	return writeTable(fname, "variables", VarCandidate{}, len(vars), func(i int) interface{} {
+		return &vars[i]
+	})
+}
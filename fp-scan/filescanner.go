@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/gob"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -20,6 +22,7 @@ type fscanner struct {
 
 	fout *fits.File
 	tbl  *fits.Table
+	rows []ForcedPhotData // rows written so far, kept for checkpoints
 }
 
 type ForcedPhotData struct {
@@ -27,13 +30,14 @@ type ForcedPhotData struct {
 	Field        int32      `fits:"field"`
 	CamColFilter int32      `fits:"camcol_filter"`
 	NbSrc        int32      `fits:"nsrc"`
-	RaMinMax     [2]float64 `fits:"ra_mnx"`
+	RaMinMax     [2]float64 `fits:"ra_mnx"` // min > max when crossing ra=0
 	DecMinMax    [2]float64 `fits:"dec_mnx"`
 	IDMinMax     [2]int64   `fits:"id_mnx"`
 	OIDMinMax    [2]int64   `fits:"oid_mnx"`
 	FluxMinMax   [2]float64 `fits:"flux_mnx"`
 	NbFluxOk     int32      `fits:"nfluxok"`
 	FluxMean     float64    `fits:"fluxmean"`
+	NbSrcIn      int32      `fits:"nsrcin"` // number of sources in the selected regions
 }
 
 func imin(i, j int64) int64 {
@@ -58,8 +62,10 @@ func NewFileScanner(name string) lsst.P {
 
 	proc.Config = proc.config
 	proc.Start = proc.start
-	proc.Proc = proc.proc
+	proc.Map = proc.read
+	proc.Reduce = proc.write
 	proc.Stop = proc.stop
+	proc.Checkpointer = proc
 	return proc
 }
 
@@ -106,43 +112,33 @@ func (proc *fscanner) start() error {
 	return err
 }
 
-func (proc *fscanner) proc(f lsst.File) error {
+// read extracts the summary data of a forced-photometry file.
+// read is run concurrently on multiple files.
+func (proc *fscanner) read(f lsst.File) (interface{}, error) {
 	var err error
 	proc.Infof("processing [%s] filter-id=%s camcol=%v...\n",
 		f.Name, string(f.Filter), f.CamCol,
 	)
-	rr, err := os.Open(f.Name)
+	ff, err := lsst.OpenFITS(f.Name)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer rr.Close()
+	defer ff.Close()
 
-	ff, err := fits.Open(rr)
+	ccid, err := lsst.CamColIndex(f.CamCol)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer ff.Close()
-
-	// update run list with fields min/max values
-	if rf, ok := proc.RunFMMDb[f.Run]; !ok {
-		proc.RunFMMDb[f.Run] = lsst.RunFieldMinMax{
-			Run:      f.Run,
-			FieldMin: f.Field,
-			FieldMax: f.Field,
-		}
-	} else {
-		if rf.FieldMin > f.Field {
-			rf.FieldMin = f.Field
-		}
-		if rf.FieldMax < f.Field {
-			rf.FieldMax = f.Field
-		}
-		proc.RunFMMDb[f.Run] = rf
+	fid, err := proc.FilterSet.ID(f.Filter)
+	if err != nil {
+		return nil, err
 	}
+	camcolfilter := int32(10*ccid + fid)
 
-	camcolfilter := int32(10*lsst.CamColID(f.CamCol) + lsst.FilterID(f.Filter))
-
-	table := ff.HDU(1).(*fits.Table)
+	table, err := ff.Table()
+	if err != nil {
+		return nil, err
+	}
 	defer table.Close()
 
 	nrows := table.NumRows()
@@ -164,9 +160,12 @@ func (proc *fscanner) proc(f lsst.File) error {
 
 	rows, err := table.Read(0, nrows)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer rows.Close()
+
+	// ra min/max are computed on the circle, once all ra are known.
+	ras := make([]float64, 0, int(nrows))
 	for rows.Next() {
 
 		data := struct {
@@ -179,7 +178,7 @@ func (proc *fscanner) proc(f lsst.File) error {
 
 		err = rows.Scan(&data)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		//fmt.Printf(">>> %v\n", data)
@@ -194,8 +193,7 @@ func (proc *fscanner) proc(f lsst.File) error {
 		fpdata.OIDMinMax[0] = imin(fpdata.OIDMinMax[0], data.OID)
 		fpdata.OIDMinMax[1] = imax(fpdata.OIDMinMax[1], data.OID)
 
-		fpdata.RaMinMax[0] = math.Min(fpdata.RaMinMax[0], ra)
-		fpdata.RaMinMax[1] = math.Max(fpdata.RaMinMax[1], ra)
+		ras = append(ras, ra)
 
 		fpdata.DecMinMax[0] = math.Min(fpdata.DecMinMax[0], dec)
 		fpdata.DecMinMax[1] = math.Max(fpdata.DecMinMax[1], dec)
@@ -206,6 +204,14 @@ func (proc *fscanner) proc(f lsst.File) error {
 			fpdata.NbFluxOk += 1
 			fpdata.FluxMean += data.Flux
 		}
+
+		if proc.Region.Contains(lsst.RaDec{Ra: ra, Dec: dec}) {
+			fpdata.NbSrcIn += 1
+		}
+	}
+
+	if len(ras) > 0 {
+		fpdata.RaMinMax[0], fpdata.RaMinMax[1] = lsst.RaRange(ras)
 	}
 
 	if fpdata.NbFluxOk > 0 {
@@ -214,18 +220,80 @@ func (proc *fscanner) proc(f lsst.File) error {
 
 	err = rows.Err()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return fpdata, err
+}
+
+// write merges the summary data of a file into the output table.
+// write is called sequentially, in the order of the input files.
+func (proc *fscanner) write(f lsst.File, v interface{}) error {
+	var err error
+	fpdata := v.(ForcedPhotData)
+
+	// update run list with fields min/max values
+	if rf, ok := proc.RunFMMDb[f.Run]; !ok {
+		proc.RunFMMDb[f.Run] = lsst.RunFieldMinMax{
+			Run:      f.Run,
+			FieldMin: f.Field,
+			FieldMax: f.Field,
+		}
+	} else {
+		if rf.FieldMin > f.Field {
+			rf.FieldMin = f.Field
+		}
+		if rf.FieldMax < f.Field {
+			rf.FieldMax = f.Field
+		}
+		proc.RunFMMDb[f.Run] = rf
 	}
 
 	err = proc.tbl.Write(&fpdata)
 	if err != nil {
 		return err
 	}
+	proc.rows = append(proc.rows, fpdata)
 
 	//proc.Infof("processing [%s] filter-id=%v camcol=%v... [done]\n", f.Name, f.Filter, f.CamCol)
 	return err
 }
 
+// fscanState is the state of a fscanner saved in checkpoints.
+type fscanState struct {
+	Rows     []ForcedPhotData
+	RunFMMDb map[int]lsst.RunFieldMinMax
+}
+
+// Checkpoint implements lsst.Checkpointer
+func (proc *fscanner) Checkpoint(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(fscanState{
+		Rows:     proc.rows,
+		RunFMMDb: proc.RunFMMDb,
+	})
+}
+
+// Restore implements lsst.Checkpointer
+func (proc *fscanner) Restore(r io.Reader) error {
+	var state fscanState
+	err := gob.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return err
+	}
+
+	for i := range state.Rows {
+		err = proc.tbl.Write(&state.Rows[i])
+		if err != nil {
+			return err
+		}
+	}
+	proc.rows = state.Rows
+	for run, rfmm := range state.RunFMMDb {
+		proc.RunFMMDb[run] = rfmm
+	}
+	return err
+}
+
 func (proc *fscanner) stop() error {
 	var err error
 	stats, err := os.Create(filepath.Join(proc.OutputDir, "stats.txt"))
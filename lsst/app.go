@@ -1,6 +1,7 @@
 package lsst
 
 import (
+	"context"
 	"time"
 
 	"github.com/gonuts/logger"
@@ -32,6 +33,13 @@ type P interface {
 	StopProcess() error
 }
 
+// ContextProcessor models processors which can stop processing files
+// when a context is done.
+type ContextProcessor interface {
+	// ProcessContext processes a region of the sky until ctx is done
+	ProcessContext(ctx context.Context) error
+}
+
 // Options is any value passed to processors to provide additional user-defined configuration data.
 type Options interface{}
 
@@ -59,38 +67,80 @@ func (app *App) Configure(opts Options) error {
 
 // Run runs the processors (Start/Process/Stop)
 func (app *App) Run() error {
+	return app.RunContext(context.Background())
+}
+
+// RunContext runs the processors (Start/Process/Stop).
+// When ctx is done, processing stops after the files being processed
+// and every processor is still stopped, so outputs are properly flushed.
+// Every started processor is stopped, even when another one failed to
+// start or stop: RunContext returns the first error.
+func (app *App) RunContext(ctx context.Context) error {
 	var err error
 	start := time.Now()
 	msg.Infof("run...\n")
 	msg.Infof("start...\n")
-	for _, proc := range app.Procs {
+	for i, proc := range app.Procs {
 		err = proc.StartProcess()
 		if err != nil {
+			msg.Errorf("start... [error]: %v\n", err)
+			app.stop(app.Procs[:i])
 			return err
 		}
 	}
 	msg.Infof("start... [done]\n")
 
 	msg.Infof("process...\n")
+	var perr error
 	for _, proc := range app.Procs {
-		err = proc.Process()
-		if err != nil {
-			return err
+		if cproc, ok := proc.(ContextProcessor); ok {
+			perr = cproc.ProcessContext(ctx)
+		} else {
+			perr = ctx.Err()
+			if perr == nil {
+				perr = proc.Process()
+			}
 		}
-	}
-	msg.Infof("process... [done]\n")
-
-	msg.Infof("stop...\n")
-	for _, proc := range app.Procs {
-		err = proc.StopProcess()
-		if err != nil {
-			return err
+		if perr != nil {
+			break
 		}
 	}
-	msg.Infof("stop... [done]\n")
+	switch {
+	case perr != nil && ctx.Err() != nil:
+		msg.Warnf("process... [interrupted]\n")
+	case perr != nil:
+		msg.Errorf("process... [error]: %v\n", perr)
+	default:
+		msg.Infof("process... [done]\n")
+	}
+
+	err = app.stop(app.Procs)
 
 	delta := time.Since(start)
 	msg.Infof("run... [done] (%v)\n", delta)
 
+	if perr != nil {
+		return perr
+	}
+	return err
+}
+
+// stop stops all the processors procs, returning the first error.
+func (app *App) stop(procs []P) error {
+	var err error
+	msg.Infof("stop...\n")
+	for _, proc := range procs {
+		e := proc.StopProcess()
+		if e == nil {
+			continue
+		}
+		msg.Errorf("stop... [error]: %v\n", e)
+		if err == nil {
+			err = e
+		}
+	}
+	if err == nil {
+		msg.Infof("stop... [done]\n")
+	}
 	return err
 }
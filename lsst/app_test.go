@@ -0,0 +1,97 @@
+package lsst
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// recProc is a processor recording its calls, and failing the ones in errs.
+type recProc struct {
+	name  string
+	calls *[]string
+	errs  map[string]bool
+}
+
+func (p recProc) call(stage string) error {
+	*p.calls = append(*p.calls, p.name+"."+stage)
+	if p.errs[stage] {
+		return fmt.Errorf("%s: %s failed", p.name, stage)
+	}
+	return nil
+}
+
+func (p recProc) StartProcess() error { return p.call("start") }
+func (p recProc) Process() error      { return p.call("process") }
+func (p recProc) StopProcess() error  { return p.call("stop") }
+
+func TestAppRun(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		errs  [3]map[string]bool // failing stages of each processor
+		calls []string
+		err   string
+	}{
+		{
+			name: "ok",
+			calls: []string{
+				"p0.start", "p1.start", "p2.start",
+				"p0.process", "p1.process", "p2.process",
+				"p0.stop", "p1.stop", "p2.stop",
+			},
+		},
+		{
+			name: "start-error",
+			errs: [3]map[string]bool{1: {"start": true}},
+			calls: []string{
+				"p0.start", "p1.start",
+				"p0.stop",
+			},
+			err: "p1: start failed",
+		},
+		{
+			name: "process-error",
+			errs: [3]map[string]bool{1: {"process": true}, 2: {"stop": true}},
+			calls: []string{
+				"p0.start", "p1.start", "p2.start",
+				"p0.process", "p1.process",
+				"p0.stop", "p1.stop", "p2.stop",
+			},
+			err: "p1: process failed",
+		},
+		{
+			name: "stop-errors",
+			errs: [3]map[string]bool{0: {"stop": true}, 1: {"stop": true}},
+			calls: []string{
+				"p0.start", "p1.start", "p2.start",
+				"p0.process", "p1.process", "p2.process",
+				"p0.stop", "p1.stop", "p2.stop",
+			},
+			err: "p0: stop failed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			var app App
+			for i, errs := range tc.errs {
+				app.Procs = append(app.Procs, recProc{
+					name:  fmt.Sprintf("p%d", i),
+					calls: &calls,
+					errs:  errs,
+				})
+			}
+
+			err := app.RunContext(context.Background())
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || err.Error() != tc.err):
+				t.Fatalf("got error %v (want=%q)", err, tc.err)
+			}
+			if !reflect.DeepEqual(calls, tc.calls) {
+				t.Fatalf("got calls:\n%q\nwant:\n%q", calls, tc.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package lsst
+
+import (
+	"fmt"
+	"math"
+)
+
+// AssocMode describes how the measurements of forced-photometry files are
+// associated into objects.
+type AssocMode int
+
+const (
+	AssocObjectID AssocMode = iota // by objectId
+	AssocPosition                  // by position, with a friends-of-friends match
+)
+
+// ParseAssocMode returns the association mode named s ("objectId" or "position").
+// An empty string means AssocObjectID.
+func ParseAssocMode(s string) (AssocMode, error) {
+	switch s {
+	case "", "objectId":
+		return AssocObjectID, nil
+	case "position":
+		return AssocPosition, nil
+	}
+	return AssocObjectID, fmt.Errorf("lsst: invalid association mode %q (want objectId|position)", s)
+}
+
+// AssociationOptions configures the association of measurements into objects.
+type AssociationOptions struct {
+	Mode        string  // "objectId" (default) or "position"
+	MatchRadius float64 // match radius in arcsec, with Mode="position" (default: 1)
+}
+
+// WithDefaults returns the options, with default values for unset ones.
+func (o AssociationOptions) WithDefaults() AssociationOptions {
+	if o.MatchRadius == 0 {
+		o.MatchRadius = 1
+	}
+	return o
+}
+
+// FriendsOfFriends groups positions which are within radius (in degrees) of
+// each other, directly or through a chain of such pairs.
+// FriendsOfFriends returns the group of each position, as the index of the
+// first position of its group.
+func FriendsOfFriends(pos []RaDec, radius float64) []int {
+	// positions are indexed on a grid of the unit vectors, with cells the
+	// size of the chord of the match radius: pairs closer than the radius
+	// are in neighbouring cells, whatever their ra and dec.
+	chord := 2 * math.Sin(0.5*radius*deg2rad)
+	chord2 := chord * chord
+
+	vs := make([]vec3, len(pos))
+	grid := make(map[[3]int64][]int)
+	cell := func(v vec3) [3]int64 {
+		return [3]int64{
+			int64(math.Floor(v[0] / chord)),
+			int64(math.Floor(v[1] / chord)),
+			int64(math.Floor(v[2] / chord)),
+		}
+	}
+
+	uf := newUnionFind(len(pos))
+	for i, p := range pos {
+		v := unitVec(p)
+		vs[i] = v
+		c := cell(v)
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, j := range grid[[3]int64{c[0] + dx, c[1] + dy, c[2] + dz}] {
+						d := v.add(vs[j].scale(-1))
+						if d.dot(d) <= chord2 {
+							uf.union(i, j)
+						}
+					}
+				}
+			}
+		}
+		grid[c] = append(grid[c], i)
+	}
+
+	groups := make([]int, len(pos))
+	first := make(map[int]int) // first position of each group, by root
+	for i := range pos {
+		root := uf.find(i)
+		j, ok := first[root]
+		if !ok {
+			j = i
+			first[root] = i
+		}
+		groups[i] = j
+	}
+	return groups
+}
+
+// unionFind is a disjoint-set forest, with path compression and union by size.
+type unionFind struct {
+	parent []int
+	size   []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{
+		parent: make([]int, n),
+		size:   make([]int, n),
+	}
+	for i := range uf.parent {
+		uf.parent[i] = i
+		uf.size[i] = 1
+	}
+	return uf
+}
+
+func (uf *unionFind) find(i int) int {
+	root := i
+	for uf.parent[root] != root {
+		root = uf.parent[root]
+	}
+	for uf.parent[i] != root {
+		uf.parent[i], i = root, uf.parent[i]
+	}
+	return root
+}
+
+func (uf *unionFind) union(i, j int) {
+	i = uf.find(i)
+	j = uf.find(j)
+	if i == j {
+		return
+	}
+	if uf.size[i] < uf.size[j] {
+		i, j = j, i
+	}
+	uf.parent[j] = i
+	uf.size[i] += uf.size[j]
+}
@@ -0,0 +1,143 @@
+package lsst
+
+import "math"
+
+// Astrometry accumulates the positions of a source, as offsets (in arcsec)
+// in the plane tangent to the sky at a reference position, to compute their
+// mean, their scatter and, from the positions with a known epoch, a linear
+// proper-motion fit.
+type Astrometry struct {
+	Ref RaDec   // reference position: the first position
+	T0  float64 // reference epoch (MJD): the first known epoch
+
+	N            int     // number of positions
+	X, Y, XX, YY float64 // sums of the offsets and of their squares
+
+	NT               int     // number of positions with a known epoch
+	PX, PY, PXX, PYY float64 // sums of the offsets and of their squares, with a known epoch
+	T, TT, TX, TY    float64 // sums of the epochs, of their squares and of their products with the offsets
+}
+
+// ProperMotion is a linear fit of the positions of a source with time.
+type ProperMotion struct {
+	N      int     // number of positions with a known epoch
+	Epoch  float64 // mean epoch (MJD)
+	Ra     float64 // proper motion in ra, times cos(dec) (mas/yr)
+	RaErr  float64
+	Dec    float64 // proper motion in dec (mas/yr)
+	DecErr float64
+}
+
+const (
+	deg2arcsec = 3600.0
+	daysPerYr  = 365.25
+)
+
+// offset returns the offsets of p from the reference position, in arcsec.
+func (a *Astrometry) offset(p RaDec) (x, y float64) {
+	x = RaDiff(p.Ra, a.Ref.Ra) * math.Cos(a.Ref.Dec*deg2rad) * deg2arcsec
+	y = (p.Dec - a.Ref.Dec) * deg2arcsec
+	return x, y
+}
+
+// Add adds the position p, measured at the epoch mjd (0: unknown).
+func (a *Astrometry) Add(p RaDec, mjd float64) {
+	if a.N == 0 {
+		a.Ref = p
+	}
+	x, y := a.offset(p)
+	a.N++
+	a.X += x
+	a.Y += y
+	a.XX += x * x
+	a.YY += y * y
+
+	if mjd == 0 {
+		return
+	}
+	if a.NT == 0 {
+		a.T0 = mjd
+	}
+	t := mjd - a.T0
+	a.NT++
+	a.PX += x
+	a.PY += y
+	a.PXX += x * x
+	a.PYY += y * y
+	a.T += t
+	a.TT += t * t
+	a.TX += t * x
+	a.TY += t * y
+}
+
+// Mean returns the mean position.
+func (a Astrometry) Mean() RaDec {
+	if a.N == 0 {
+		return RaDec{Ra: math.NaN(), Dec: math.NaN()}
+	}
+	n := float64(a.N)
+	return RaDec{
+		Ra:  RaWrap(a.Ref.Ra + a.X/n/deg2arcsec/math.Cos(a.Ref.Dec*deg2rad)),
+		Dec: a.Ref.Dec + a.Y/n/deg2arcsec,
+	}
+}
+
+// Sigma returns the standard deviation of the positions in ra, times cos(dec),
+// and in dec (in arcsec).
+func (a Astrometry) Sigma() (ra, dec float64) {
+	if a.N < 2 {
+		return math.NaN(), math.NaN()
+	}
+	n := float64(a.N)
+	ra = math.Sqrt(math.Max(0, (a.XX-a.X*a.X/n)/(n-1)))
+	dec = math.Sqrt(math.Max(0, (a.YY-a.Y*a.Y/n)/(n-1)))
+	return ra, dec
+}
+
+// ProperMotion returns the least-squares linear fit of the positions with
+// a known epoch. The errors are estimated from the scatter of the positions
+// about the fit. The proper motion is NaN with less than 2 distinct epochs,
+// and its errors with less than 3 positions.
+func (a Astrometry) ProperMotion() ProperMotion {
+	nan := math.NaN()
+	pm := ProperMotion{
+		N:      a.NT,
+		Epoch:  nan,
+		Ra:     nan,
+		RaErr:  nan,
+		Dec:    nan,
+		DecErr: nan,
+	}
+	if a.NT == 0 {
+		return pm
+	}
+
+	n := float64(a.NT)
+	mt := a.T / n
+	pm.Epoch = a.T0 + mt
+
+	stt := a.TT - n*mt*mt
+	if a.NT < 2 || !(stt > 0) {
+		return pm
+	}
+
+	fit := func(sx, sxx, stx float64) (slope, err float64) {
+		mx := sx / n
+		stx -= n * mt * mx
+		slope = stx / stt
+		err = nan
+		if a.NT > 2 {
+			rss := math.Max(0, sxx-n*mx*mx-slope*stx)
+			err = math.Sqrt(rss / (n - 2) / stt)
+		}
+		return slope, err
+	}
+
+	// arcsec/day to mas/yr
+	const scale = 1e3 * daysPerYr
+	ra, raErr := fit(a.PX, a.PXX, a.TX)
+	dec, decErr := fit(a.PY, a.PYY, a.TY)
+	pm.Ra, pm.RaErr = ra*scale, raErr*scale
+	pm.Dec, pm.DecErr = dec*scale, decErr*scale
+	return pm
+}
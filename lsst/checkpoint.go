@@ -0,0 +1,113 @@
+package lsst
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Checkpointer models processors which can save and restore their
+// accumulated state, so an interrupted job can be resumed.
+type Checkpointer interface {
+	// Checkpoint writes the processor state to w
+	Checkpoint(w io.Writer) error
+
+	// Restore reads back the processor state from r
+	Restore(r io.Reader) error
+}
+
+// checkpoint is the on-disk state of a Processor.
+type checkpoint struct {
+	Seen     []string // names of all the files already visited
+	Done     []File
+	BadFiles []BadFile
+	Stats    Stats
+	State    []byte // processor-specific state
+}
+
+func (proc *Processor) checkpointName() string {
+	return filepath.Join(proc.OutputDir, "checkpoint.gob")
+}
+
+// writeCheckpoint saves the current state of the processor to OutputDir.
+func (proc *Processor) writeCheckpoint() error {
+	var err error
+	ckpt := checkpoint{
+		Seen:     make([]string, 0, len(proc.seen)),
+		Done:     proc.Done,
+		BadFiles: proc.BadFiles,
+		Stats:    proc.Stats,
+	}
+	if proc.aborted {
+		// the bad file which stopped the job was not visited.
+		ckpt.BadFiles = ckpt.BadFiles[:len(ckpt.BadFiles)-1]
+		ckpt.Stats.BadFiles -= 1
+	}
+	for name := range proc.seen {
+		ckpt.Seen = append(ckpt.Seen, name)
+	}
+
+	if proc.Checkpointer != nil {
+		var state bytes.Buffer
+		err = proc.Checkpointer.Checkpoint(&state)
+		if err != nil {
+			return err
+		}
+		ckpt.State = state.Bytes()
+	}
+
+	// write to a temporary file first so a crash while checkpointing
+	// does not corrupt the previous checkpoint.
+	fname := proc.checkpointName()
+	tmp := fname + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = gob.NewEncoder(f).Encode(ckpt)
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, fname)
+}
+
+// readCheckpoint restores the state of the processor from OutputDir.
+func (proc *Processor) readCheckpoint() error {
+	f, err := os.Open(proc.checkpointName())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var ckpt checkpoint
+	err = gob.NewDecoder(f).Decode(&ckpt)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range ckpt.Seen {
+		proc.seen[name] = true
+	}
+	proc.Done = ckpt.Done
+	proc.BadFiles = ckpt.BadFiles
+	proc.Stats = ckpt.Stats
+
+	if proc.Checkpointer != nil && ckpt.State != nil {
+		err = proc.Checkpointer.Restore(bytes.NewReader(ckpt.State))
+		if err != nil {
+			return err
+		}
+	}
+
+	return err
+}
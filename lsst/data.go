@@ -10,7 +10,17 @@ type RaDec struct {
 	Dec float64
 }
 
-// RaDecLim represents a portion of the sky
+// RaDecLim represents a portion of the sky, binned in ra-dec cells.
+//
+// Along each axis, the binning may be described by any two of the range
+// (Min, Max), the number of cells (NbRa, NbDec) and the cell width
+// (DeltaRa, DeltaDec): Normalize derives the third one.
+//
+// A region with Min.Ra > Max.Ra crosses ra=0: it spans from Min.Ra to 360
+// and from 0 to Max.Ra.
+//
+// In EqualArea mode, the number of ra cells of each dec band scales with
+// cos(dec), NbRa being the number of ra cells at the equator.
 type RaDecLim struct {
 	Min RaDec
 	Max RaDec
@@ -20,13 +30,22 @@ type RaDecLim struct {
 
 	DeltaRa  float64
 	DeltaDec float64
+
+	EqualArea bool
+
+	bands []int // index of the first cell of each dec band, in EqualArea mode
 }
 
-// RunFieldMinMax represents a SDSS run with a range of field numbers
+// RunFieldMinMax represents a SDSS run with a range of field numbers.
+// CamCols and Filters optionally restrict the camcols and filters of the run
+// (default: all camcols and the job filters.)
 type RunFieldMinMax struct {
 	Run      int
 	FieldMin int
 	FieldMax int
+
+	CamCols []int
+	Filters []string
 }
 
 // RunFieldCamCol represents a SDSS [run, field, camcol]
@@ -36,11 +55,18 @@ type RunFieldCamCol struct {
 	CamCol int
 }
 
-var Filters = [...]byte{'u', 'g', 'r', 'i', 'z', 'y'}
+// CamCols is the list of all SDSS camcol indices
+var CamCols = []int{1, 2, 3, 4, 5, 6}
 
-// FilterID2Filter converts a filter index [1-6] to the SDSS filter byte
+// FilterID2Filter converts a filter index [1-6] to the filter byte
+// of the DefaultFilterSet.
+// FilterID2Filter panics on an invalid index.
 func FilterID2Filter(i int) byte {
-	return Filters[i-1]
+	b, err := DefaultFilterSet.Filter(i)
+	if err != nil {
+		panic(err)
+	}
+	return b
 }
 
 // CamColID2CamCol converts a camcol index [1-6] to the SDSS camcol byte
@@ -48,30 +74,164 @@ func CamColID2CamCol(i int) byte {
 	return byte(i)
 }
 
-// FilterID returns the SDSS filter index from the according SDSS filter byte
+// FilterID returns the filter index of the DefaultFilterSet from the
+// according filter byte.
+// FilterID panics on an invalid filter. See FilterIndex.
 func FilterID(b byte) int {
-	for i, v := range Filters {
-		if v == b {
-			return i + 1
-		}
+	i, err := FilterIndex(b)
+	if err != nil {
+		panic(err)
 	}
-	panic(fmt.Errorf("invalid filter byte %q", b))
+	return i
+}
+
+// FilterIndex returns the filter index of the DefaultFilterSet from the
+// according filter byte.
+func FilterIndex(b byte) (int, error) {
+	return DefaultFilterSet.ID(b)
 }
 
-// CamColID returns the camcol index from the according SDSS camcol byte
+// CamColID returns the camcol index from the according SDSS camcol byte.
+// CamColID panics on an invalid camcol. See CamColIndex.
 func CamColID(b byte) int {
-	ccid := int(b)
-	if ccid < 1 || ccid > 6 {
-		panic(fmt.Errorf("invalid camcol byte %q", b))
+	ccid, err := CamColIndex(b)
+	if err != nil {
+		panic(err)
 	}
 	return ccid
 }
 
-// FluxRec holds individual (or sum) flux measurement(s)
+// CamColIndex returns the camcol index from the according SDSS camcol byte
+func CamColIndex(b byte) (int, error) {
+	ccid := int(b)
+	if ccid < 1 || ccid > len(CamCols) {
+		return 0, fmt.Errorf("lsst: invalid camcol byte %q", b)
+	}
+	return ccid, nil
+}
+
+// FluxRec holds individual (or sum) flux measurement(s).
+//
+// The mean and variance are accumulated with Welford's online algorithm,
+// which is numerically stable even for large fluxes.
+// The inverse-variance weighted mean of the measurements with a valid
+// flux error is accumulated with West's weighted variant of the algorithm.
 type FluxRec struct {
-	N          int
-	SumMean    float64
-	SqSumSigma float64
+	N  int     // number of measurements
+	Mu float64 // mean of the measurements
+	M2 float64 // sum of squared deviations from the mean
+
+	NW  int     // number of measurements with a valid flux error
+	W   float64 // sum of the weights (1/err^2)
+	WMu float64 // weighted mean of the measurements
+	WM2 float64 // weighted sum of squared deviations from the weighted mean
+}
+
+// Add adds a new flux measurement.
+func (rec *FluxRec) Add(flux float64) {
+	rec.N += 1
+	delta := flux - rec.Mu
+	rec.Mu += delta / float64(rec.N)
+	rec.M2 += delta * (flux - rec.Mu)
+}
+
+// AddErr adds a new flux measurement with its error.
+// Measurements without a valid (finite and positive) error only enter
+// the unweighted statistics.
+func (rec *FluxRec) AddErr(flux, err float64) {
+	rec.Add(flux)
+	if !(err > 0) || math.IsInf(err, 0) {
+		return
+	}
+
+	w := 1 / (err * err)
+	rec.NW += 1
+	rec.W += w
+	delta := flux - rec.WMu
+	rec.WMu += delta * w / rec.W
+	rec.WM2 += w * delta * (flux - rec.WMu)
+}
+
+// Merge merges the measurements of o into rec.
+func (rec *FluxRec) Merge(o FluxRec) {
+	switch {
+	case o.N == 0:
+		return
+	case rec.N == 0:
+		*rec = o
+		return
+	}
+
+	n := rec.N + o.N
+	delta := o.Mu - rec.Mu
+	rec.Mu += delta * float64(o.N) / float64(n)
+	rec.M2 += o.M2 + delta*delta*float64(rec.N)*float64(o.N)/float64(n)
+	rec.N = n
+
+	switch {
+	case o.NW == 0:
+		return
+	case rec.NW == 0:
+		rec.NW, rec.W, rec.WMu, rec.WM2 = o.NW, o.W, o.WMu, o.WM2
+		return
+	}
+
+	w := rec.W + o.W
+	delta = o.WMu - rec.WMu
+	rec.WMu += delta * o.W / w
+	rec.WM2 += o.WM2 + delta*delta*rec.W*o.W/w
+	rec.W = w
+	rec.NW += o.NW
+}
+
+// Mean returns the mean of the measurements.
+func (rec FluxRec) Mean() float64 {
+	return rec.Mu
+}
+
+// Variance returns the (unbiased) sample variance of the measurements,
+// or 0 with less than 2 measurements.
+func (rec FluxRec) Variance() float64 {
+	if rec.N < 2 {
+		return 0
+	}
+	return rec.M2 / float64(rec.N-1)
+}
+
+// StdDev returns the sample standard deviation of the measurements.
+func (rec FluxRec) StdDev() float64 {
+	return math.Sqrt(rec.Variance())
+}
+
+// StdErr returns the standard error on the mean of the measurements.
+func (rec FluxRec) StdErr() float64 {
+	if rec.N < 1 {
+		return 0
+	}
+	return rec.StdDev() / math.Sqrt(float64(rec.N))
+}
+
+// WMean returns the inverse-variance weighted mean of the measurements.
+func (rec FluxRec) WMean() float64 {
+	return rec.WMu
+}
+
+// WMeanErr returns the error on the weighted mean of the measurements,
+// or 0 without any measurement with a valid error.
+func (rec FluxRec) WMeanErr() float64 {
+	if rec.W <= 0 {
+		return 0
+	}
+	return 1 / math.Sqrt(rec.W)
+}
+
+// RedChi2 returns the reduced chi-square of the measurements about their
+// weighted mean, or 0 with less than 2 measurements with a valid error.
+func (rec FluxRec) RedChi2() float64 {
+	if rec.NW < 2 {
+		return 0
+	}
+	return rec.WM2 / float64(rec.NW-1)
 }
 
 // FPMeasure holds multi-color informations extracted from forced-photometry FITS files
@@ -80,27 +240,20 @@ type FPMeasure struct {
 	OID    int64
 	RaDec  RaDec
 	Fluxes []FluxRec
+	Robust []RobustStats // outlier-resistant statistics of the fluxes, if computed
+	Mags   []Magnitude   // magnitudes of the mean fluxes, if computed
+	Var    []Variability // variability indices of the fluxes, if computed
+	Astrom Astrometry    // positions of the measurements
 }
 
 // Add adds a new flux measure
 func (m *FPMeasure) Add(idx int, flux float64) {
-	v := &m.Fluxes[idx]
-	v.N += 1
-	v.SumMean += flux
-	v.SqSumSigma += flux * flux
-}
-
-// ComputeMean computes the mean and standard deviation of this measurement
-func (m *FPMeasure) ComputeMean() {
-	for i, flx := range m.Fluxes {
-		if flx.N < 1 {
-			continue
-		}
-		n := float64(flx.N)
-		flx.SumMean /= n
-		flx.SqSumSigma = math.Sqrt(flx.SqSumSigma/n - flx.SumMean*flx.SumMean)
-		m.Fluxes[i] = flx
-	}
+	m.Fluxes[idx].Add(flux)
+}
+
+// AddErr adds a new flux measure with its error
+func (m *FPMeasure) AddErr(idx int, flux, err float64) {
+	m.Fluxes[idx].AddErr(flux, err)
 }
 
 type FPMeasures map[int64]FPMeasure
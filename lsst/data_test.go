@@ -0,0 +1,128 @@
+package lsst
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFluxRecMerge(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fluxes []float64
+		errs   []float64 // 0: no valid error
+		split  int       // measurements [0, split) go to the first record
+	}{
+		{
+			name:   "small",
+			fluxes: []float64{10, 12, 11, 15},
+			errs:   []float64{1, 2, 1, 3},
+			split:  2,
+		},
+		{
+			name:   "large-fluxes",
+			fluxes: []float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16, 1e9 + 1},
+			errs:   []float64{2, 1, 3, 1, 2},
+			split:  3,
+		},
+		{
+			name:   "missing-errors",
+			fluxes: []float64{10, 12, 11, 15, 9},
+			errs:   []float64{1, 0, 1, 0, 2},
+			split:  2,
+		},
+		{
+			name:   "no-errors-in-first",
+			fluxes: []float64{10, 12, 11, 15},
+			errs:   []float64{0, 0, 1, 2},
+			split:  2,
+		},
+		{
+			name:   "no-errors-in-second",
+			fluxes: []float64{10, 12, 11, 15},
+			errs:   []float64{1, 2, 0, 0},
+			split:  2,
+		},
+		{
+			name:   "empty-first",
+			fluxes: []float64{10, 12, 11},
+			errs:   []float64{1, 2, 1},
+			split:  0,
+		},
+		{
+			name:   "empty-second",
+			fluxes: []float64{10, 12, 11},
+			errs:   []float64{1, 2, 1},
+			split:  3,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var a, b, all FluxRec
+			for i, flux := range tc.fluxes {
+				all.AddErr(flux, tc.errs[i])
+				if i < tc.split {
+					a.AddErr(flux, tc.errs[i])
+				} else {
+					b.AddErr(flux, tc.errs[i])
+				}
+			}
+			a.Merge(b)
+
+			if a.N != all.N || a.NW != all.NW {
+				t.Fatalf("got N=%d NW=%d (want=%d, %d)", a.N, a.NW, all.N, all.NW)
+			}
+			for _, v := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"mean", a.Mean(), all.Mean()},
+				{"variance", a.Variance(), all.Variance()},
+				{"wmean", a.WMean(), all.WMean()},
+				{"wmean-err", a.WMeanErr(), all.WMeanErr()},
+				{"red-chi2", a.RedChi2(), all.RedChi2()},
+			} {
+				if !closeTo(v.got, v.want, 1e-8) {
+					t.Errorf("%s: got=%v (want=%v)", v.name, v.got, v.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFluxRecAddErr(t *testing.T) {
+	var rec FluxRec
+	for i, flux := range []float64{10, 12, 11, 15} {
+		rec.AddErr(flux, []float64{1, 2, 1, 0}[i])
+	}
+
+	// weights: 1, 1/4, 1 (the last measurement has no valid error)
+	wmean := (10 + 12.0/4 + 11) / 2.25
+	chi2 := sq(10-wmean) + sq(12-wmean)/4 + sq(11-wmean)
+	for _, v := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"mean", rec.Mean(), 12},
+		{"variance", rec.Variance(), 14.0 / 3},
+		{"wmean", rec.WMean(), wmean},
+		{"wmean-err", rec.WMeanErr(), 1 / math.Sqrt(2.25)},
+		{"red-chi2", rec.RedChi2(), chi2 / 2},
+	} {
+		if !closeTo(v.got, v.want, 1e-12) {
+			t.Errorf("%s: got=%v (want=%v)", v.name, v.got, v.want)
+		}
+	}
+	if rec.N != 4 || rec.NW != 3 {
+		t.Errorf("got N=%d NW=%d (want=4, 3)", rec.N, rec.NW)
+	}
+}
+
+func sq(x float64) float64 { return x * x }
+
+// closeTo returns whether a and b are equal within the relative tolerance
+// tol, or are both NaN.
+func closeTo(a, b, tol float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Abs(a-b) <= tol*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
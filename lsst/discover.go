@@ -0,0 +1,192 @@
+package lsst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultNamePattern matches the names of the DC_2013 forced-photometry files.
+const DefaultNamePattern = `(?:^|/)forcedsources-(?P<run>\d+)-(?P<filter>[a-z])(?P<camcol>\d)-(?P<field>\d+)\.fits$`
+
+// NameParser extracts the run, field, camcol and filter of a file from its path.
+//
+// A NameParser is described by a regular expression with the named groups
+// run, field, camcol and filter.
+// The expression is matched against the slash-separated path of the file,
+// relative to the base directory.
+type NameParser struct {
+	BaseDir string
+	re      *regexp.Regexp
+	groups  map[string]int
+}
+
+// NewNameParser creates a new parser for files under basedir.
+// An empty pattern means DefaultNamePattern.
+func NewNameParser(basedir, pattern string) (*NameParser, error) {
+	if pattern == "" {
+		pattern = DefaultNamePattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("lsst: invalid name pattern: %v", err)
+	}
+
+	p := &NameParser{
+		BaseDir: basedir,
+		re:      re,
+		groups:  make(map[string]int),
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			p.groups[name] = i
+		}
+	}
+
+	for _, name := range []string{"run", "field", "camcol", "filter"} {
+		if _, ok := p.groups[name]; !ok {
+			return nil, fmt.Errorf("lsst: name pattern has no %q group", name)
+		}
+	}
+	return p, err
+}
+
+// Parse returns the input file named name.
+func (p *NameParser) Parse(name string) (File, error) {
+	var err error
+	rel := name
+	if p.BaseDir != "" {
+		if r, err := filepath.Rel(p.BaseDir, name); err == nil {
+			rel = r
+		}
+	}
+
+	// match the name of the uncompressed file
+	for _, suffix := range Suffixes {
+		if suffix != "" && strings.HasSuffix(rel, ".fits"+suffix) {
+			rel = strings.TrimSuffix(rel, suffix)
+			break
+		}
+	}
+
+	m := p.re.FindStringSubmatch(filepath.ToSlash(rel))
+	if m == nil {
+		return File{}, fmt.Errorf("lsst: file name [%s] does not match name pattern", name)
+	}
+
+	f := File{Name: name}
+	f.Run, err = strconv.Atoi(m[p.groups["run"]])
+	if err != nil {
+		return f, fmt.Errorf("lsst: invalid run in [%s]: %v", name, err)
+	}
+
+	f.Field, err = strconv.Atoi(m[p.groups["field"]])
+	if err != nil {
+		return f, fmt.Errorf("lsst: invalid field in [%s]: %v", name, err)
+	}
+
+	camcol, err := strconv.Atoi(m[p.groups["camcol"]])
+	if err != nil {
+		return f, fmt.Errorf("lsst: invalid camcol in [%s]: %v", name, err)
+	}
+	f.CamCol = byte(camcol)
+
+	filter := m[p.groups["filter"]]
+	if len(filter) != 1 {
+		return f, fmt.Errorf("lsst: invalid filter %q in [%s]", filter, name)
+	}
+	f.Filter = filter[0]
+
+	return f, err
+}
+
+// isFITS returns whether name looks like the name of a (possibly compressed) FITS file.
+func isFITS(name string) bool {
+	for _, suffix := range Suffixes {
+		if strings.HasSuffix(name, ".fits"+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// discover collects the input files matching the glob patterns (if any)
+// or all the FITS files under the base directory.
+// discover returns the files which could be parsed, sorted by run, field,
+// camcol and filter, and the names of the files which could not be parsed.
+func discover(p *NameParser, globs []string) ([]File, []string, error) {
+	var (
+		err   error
+		names []string
+	)
+
+	switch {
+	case len(globs) > 0:
+		for _, glob := range globs {
+			matches, err := filepath.Glob(filepath.Join(p.BaseDir, glob))
+			if err != nil {
+				return nil, nil, fmt.Errorf("lsst: invalid glob pattern %q: %v", glob, err)
+			}
+			names = append(names, matches...)
+		}
+
+	default:
+		err = filepath.Walk(p.BaseDir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() && isFITS(path) {
+				names = append(names, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		files []File
+		bad   []string
+		seen  = make(map[string]bool, len(names))
+	)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		f, err := p.Parse(name)
+		if err != nil {
+			bad = append(bad, name)
+			continue
+		}
+		files = append(files, f)
+	}
+
+	sort.Sort(filesByRun(files))
+	return files, bad, err
+}
+
+type filesByRun []File
+
+func (p filesByRun) Len() int      { return len(p) }
+func (p filesByRun) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p filesByRun) Less(i, j int) bool {
+	a, b := p[i], p[j]
+	switch {
+	case a.Run != b.Run:
+		return a.Run < b.Run
+	case a.Field != b.Field:
+		return a.Field < b.Field
+	case a.CamCol != b.CamCol:
+		return a.CamCol < b.CamCol
+	case a.Filter != b.Filter:
+		return a.Filter < b.Filter
+	}
+	return a.Name < b.Name
+}
@@ -0,0 +1,89 @@
+package lsst
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultEpochKey is the header keyword holding the epoch (MJD) of an exposure.
+const DefaultEpochKey = "MJD-OBS"
+
+// EpochOptions configures how the epoch of input files is found.
+type EpochOptions struct {
+	Key    string // header keyword holding the MJD of a file (default: DefaultEpochKey)
+	RunMJD string // path to a text file with one "run mjd" pair per line
+}
+
+// Epochs looks up the epoch (MJD) of input files: from a header keyword of
+// the file or, when the keyword is missing, from a table of the MJD of each run.
+type Epochs struct {
+	Key  string
+	Runs map[int]float64 // MJD of each run
+}
+
+// NewEpochs creates the epoch lookup described by opts.
+func NewEpochs(opts EpochOptions) (*Epochs, error) {
+	e := &Epochs{
+		Key:  opts.Key,
+		Runs: make(map[int]float64),
+	}
+	if e.Key == "" {
+		e.Key = DefaultEpochKey
+	}
+
+	if opts.RunMJD == "" {
+		return e, nil
+	}
+
+	f, err := os.Open(opts.RunMJD)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scan := bufio.NewScanner(f)
+	for iline := 1; scan.Scan(); iline++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		toks := strings.Fields(line)
+		if len(toks) != 2 {
+			return nil, fmt.Errorf("lsst: %s:%d: want \"run mjd\" (got %q)", opts.RunMJD, iline, line)
+		}
+		run, err := strconv.Atoi(toks[0])
+		if err != nil {
+			return nil, fmt.Errorf("lsst: %s:%d: invalid run: %v", opts.RunMJD, iline, err)
+		}
+		mjd, err := strconv.ParseFloat(toks[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("lsst: %s:%d: invalid mjd: %v", opts.RunMJD, iline, err)
+		}
+		e.Runs[run] = mjd
+	}
+
+	err = scan.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return e, err
+}
+
+// MJD returns the epoch of the input file f, opened as ff.
+func (e *Epochs) MJD(f File, ff *FitsFile) (float64, error) {
+	mjd, err := ff.Float(e.Key)
+	if err == nil {
+		return mjd, err
+	}
+
+	mjd, ok := e.Runs[f.Run]
+	if !ok {
+		return 0, fmt.Errorf("lsst: no epoch for run %d (%v)", f.Run, err)
+	}
+	return mjd, nil
+}
@@ -0,0 +1,201 @@
+package lsst
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readFileList reads the list of input files from fname.
+//
+// fname may be:
+//   - a FITS file with a table holding the run, field and camcol_filter
+//     columns (e.g. the fpfsum.fits output of fp-scan),
+//   - a JSON list of bad files (e.g. the bad_files.json output of a job),
+//     with names relative to BaseDir or absolute,
+//   - a text file with one path per line (relative to BaseDir or absolute.)
+//
+// readFileList returns the files which could be parsed and the names of
+// the files which could not be parsed.
+func readFileList(fname string, layout *Layout, fs FilterSet, parser *NameParser) ([]File, []string, error) {
+	switch {
+	case strings.HasSuffix(fname, ".fits"):
+		files, err := readFileListFITS(fname, layout, fs)
+		return files, nil, err
+	case strings.HasSuffix(fname, ".json"):
+		files, err := readFileListJSON(fname, parser.BaseDir)
+		return files, nil, err
+	}
+	return readFileListText(fname, parser)
+}
+
+// fileListNeedsBaseDir returns whether the entries of the file list fname
+// are resolved against BaseDir: FITS lists go through the layout of the
+// files, and text or JSON lists may hold relative paths.
+func fileListNeedsBaseDir(fname string) (bool, error) {
+	var names []string
+	switch {
+	case strings.HasSuffix(fname, ".fits"):
+		return true, nil
+	case strings.HasSuffix(fname, ".json"):
+		files, err := readFileListJSON(fname, "")
+		if err != nil {
+			return false, err
+		}
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+	default:
+		f, err := os.Open(fname)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			name := strings.TrimSpace(scan.Text())
+			if name == "" || strings.HasPrefix(name, "#") {
+				continue
+			}
+			names = append(names, name)
+		}
+		err = scan.Err()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for _, name := range names {
+		if !filepath.IsAbs(name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func readFileListText(fname string, parser *NameParser) ([]File, []string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var (
+		files []File
+		bad   []string
+	)
+
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		name := strings.TrimSpace(scan.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(parser.BaseDir, name)
+		}
+		file, err := parser.Parse(name)
+		if err != nil {
+			bad = append(bad, name)
+			continue
+		}
+		files = append(files, file)
+	}
+
+	err = scan.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, bad, err
+}
+
+// readFileListJSON reads a list of bad files, resolving relative names
+// against basedir.
+func readFileListJSON(fname, basedir string) ([]File, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []BadFile
+	err = json.NewDecoder(f).Decode(&list)
+	if err != nil {
+		return nil, fmt.Errorf("lsst: invalid file list [%s]: %v", fname, err)
+	}
+
+	files := make([]File, 0, len(list))
+	for _, bf := range list {
+		if len(bf.Filter) != 1 {
+			return nil, fmt.Errorf("lsst: invalid filter %q for [%s]", bf.Filter, bf.Name)
+		}
+		name := bf.Name
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(basedir, name)
+		}
+		files = append(files, File{
+			Name:   name,
+			Filter: bf.Filter[0],
+			CamCol: byte(bf.CamCol),
+			Field:  bf.Field,
+			Run:    bf.Run,
+		})
+	}
+	return files, err
+}
+
+func readFileListFITS(fname string, layout *Layout, fs FilterSet) ([]File, error) {
+	f, err := OpenFITS(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table, err := f.Table()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := table.Read(0, table.NumRows())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var data struct {
+			Run          int32 `fits:"run"`
+			Field        int32 `fits:"field"`
+			CamColFilter int32 `fits:"camcol_filter"`
+		}
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		camcol := byte(data.CamColFilter / 10)
+		filter, err := fs.Filter(int(data.CamColFilter % 10))
+		if err != nil {
+			return nil, fmt.Errorf("lsst: invalid camcol_filter value %d in [%s]: %v", data.CamColFilter, fname, err)
+		}
+
+		file, err := layout.File(int(data.Run), int(data.Field), camcol, filter)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
@@ -0,0 +1,74 @@
+package lsst
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadFileListJSON(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "bad_files.json")
+	list := []BadFile{
+		{Name: "1752/forcedsources-1752-r1-0030.fits", Run: 1752, Field: 30, CamCol: 1, Filter: "r"},
+		{Name: "/data/1752/forcedsources-1752-i2-0031.fits", Run: 1752, Field: 31, CamCol: 2, Filter: "i"},
+	}
+	buf, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(fname, buf, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		basedir string
+		want    []string
+	}{
+		{
+			name:    "basedir",
+			basedir: "/sps/dc2013",
+			want: []string{
+				"/sps/dc2013/1752/forcedsources-1752-r1-0030.fits",
+				"/data/1752/forcedsources-1752-i2-0031.fits",
+			},
+		},
+		{
+			name: "no-basedir",
+			want: []string{
+				"1752/forcedsources-1752-r1-0030.fits",
+				"/data/1752/forcedsources-1752-i2-0031.fits",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files, err := readFileListJSON(fname, tc.basedir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(tc.want) {
+				t.Fatalf("got %d files (want=%d)", len(files), len(tc.want))
+			}
+			for i, f := range files {
+				if f.Name != tc.want[i] {
+					t.Errorf("file #%d: got name [%s] (want=[%s])", i, f.Name, tc.want[i])
+				}
+				if f.Run != list[i].Run || f.Field != list[i].Field ||
+					int(f.CamCol) != list[i].CamCol || string(f.Filter) != list[i].Filter {
+					t.Errorf("file #%d: got %+v (want=%+v)", i, f, list[i])
+				}
+			}
+		})
+	}
+
+	need, err := fileListNeedsBaseDir(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !need {
+		t.Errorf("a list of relative names needs BaseDir")
+	}
+}
@@ -0,0 +1,119 @@
+package lsst
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FilterSet is an ordered set of photometric filters.
+// The filter id of a filter is its index in the set, starting at 1.
+type FilterSet struct {
+	Name    string
+	Filters []byte
+}
+
+var (
+	// SDSSFilters are the SDSS u, g, r, i, z filters
+	SDSSFilters = FilterSet{Name: "sdss", Filters: []byte("ugriz")}
+
+	// LSSTFilters are the LSST u, g, r, i, z, y filters
+	LSSTFilters = FilterSet{Name: "lsst", Filters: []byte("ugrizy")}
+
+	// CFHTFilters are the CFHT MegaCam u*, g', r', i', z' filters
+	CFHTFilters = FilterSet{Name: "cfht", Filters: []byte("ugriz")}
+
+	// DefaultFilterSet is the filter set used when none is configured
+	DefaultFilterSet = LSSTFilters
+)
+
+var filterSets = struct {
+	sync.RWMutex
+	db map[string]FilterSet
+}{
+	db: map[string]FilterSet{
+		SDSSFilters.Name: SDSSFilters,
+		LSSTFilters.Name: LSSTFilters,
+		CFHTFilters.Name: CFHTFilters,
+	},
+}
+
+// RegisterFilterSet registers a new filter set, to be used from jobos.
+func RegisterFilterSet(fs FilterSet) error {
+	filterSets.Lock()
+	defer filterSets.Unlock()
+
+	// filter sets are looked up by lower-cased name
+	key := strings.ToLower(fs.Name)
+	if _, dup := filterSets.db[key]; dup {
+		return fmt.Errorf("lsst: filter set %q already registered", fs.Name)
+	}
+	// filter ids are stored as a single digit in camcol_filter values
+	if len(fs.Filters) == 0 || len(fs.Filters) > 9 {
+		return fmt.Errorf("lsst: filter set %q needs between 1 and 9 filters", fs.Name)
+	}
+	for i, b := range fs.Filters {
+		if strings.IndexByte(string(fs.Filters[:i]), b) >= 0 {
+			return fmt.Errorf("lsst: filter set %q has duplicate filter %q", fs.Name, b)
+		}
+	}
+
+	filterSets.db[key] = fs
+	return nil
+}
+
+// LookupFilterSet returns the filter set registered under name.
+// An empty name means DefaultFilterSet.
+func LookupFilterSet(name string) (FilterSet, error) {
+	if name == "" {
+		return DefaultFilterSet, nil
+	}
+
+	filterSets.RLock()
+	defer filterSets.RUnlock()
+
+	fs, ok := filterSets.db[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(filterSets.db))
+		for k := range filterSets.db {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return fs, fmt.Errorf("lsst: unknown filter set %q (known: %s)", name, strings.Join(names, ", "))
+	}
+	return fs, nil
+}
+
+// ID returns the filter id of the filter b.
+func (fs FilterSet) ID(b byte) (int, error) {
+	for i, v := range fs.Filters {
+		if v == b {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("lsst: invalid filter %q for filter set %q (want one of %q)", b, fs.Name, fs.Filters)
+}
+
+// Filter returns the filter with the filter id i.
+func (fs FilterSet) Filter(i int) (byte, error) {
+	if i < 1 || i > len(fs.Filters) {
+		return 0, fmt.Errorf("lsst: invalid filter id %d for filter set %q", i, fs.Name)
+	}
+	return fs.Filters[i-1], nil
+}
+
+// Parse returns the filter named s.
+// CFHT-style names (u*, g', ...) are accepted.
+func (fs FilterSet) Parse(s string) (byte, error) {
+	name := strings.TrimRight(s, "*'")
+	if len(name) != 1 {
+		return 0, fmt.Errorf("lsst: invalid filter name %q", s)
+	}
+	b := name[0]
+	_, err := fs.ID(b)
+	if err != nil {
+		return 0, err
+	}
+	return b, nil
+}
@@ -0,0 +1,119 @@
+package lsst
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	fits "github.com/astrogo/fitsio"
+)
+
+// Suffixes lists the suffixes tried, in turn, when looking for an input file:
+// the exact name first, then its compressed variants.
+var Suffixes = []string{"", ".gz", ".fz"}
+
+// ResolvePath returns the path to the file name, or to its first existing
+// compressed variant.
+func ResolvePath(name string) (string, os.FileInfo, error) {
+	var (
+		fi  os.FileInfo
+		err error
+	)
+	for _, suffix := range Suffixes {
+		fi, err = os.Stat(name + suffix)
+		if err == nil {
+			return name + suffix, fi, err
+		}
+	}
+	// report the error about the exact name
+	fi, err = os.Stat(name)
+	return name, fi, err
+}
+
+// FitsFile is a FITS file opened for reading, possibly through a decompressor.
+type FitsFile struct {
+	*fits.File
+
+	name string
+	f    *os.File
+	z    *gzip.Reader
+}
+
+// gzipMagic is the header of gzip-compressed files.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// OpenFITS opens the FITS file name for reading.
+// gzip-compressed files are transparently decompressed.
+// Tile-compressed files (.fz) are not supported and must first be uncompressed
+// with funpack.
+func OpenFITS(name string) (*FitsFile, error) {
+	if strings.HasSuffix(name, ".fz") {
+		return nil, fmt.Errorf("lsst: tile-compressed FITS file [%s] not supported (uncompress it with funpack)", name)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ff := &FitsFile{name: name, f: f}
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	magic, err := br.Peek(len(gzipMagic))
+	if err == nil && bytes.Equal(magic, gzipMagic) {
+		ff.z, err = gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lsst: invalid gzip file [%s]: %v", name, err)
+		}
+		r = ff.z
+	}
+
+	ff.File, err = fits.Open(r)
+	if err != nil {
+		ff.close()
+		return nil, err
+	}
+
+	return ff, nil
+}
+
+// Table returns the table of the first extension of the file, which holds
+// the sources of forced-photometry files.
+// Truncated or corrupt files without such a table are reported as errors.
+func (f *FitsFile) Table() (*fits.Table, error) {
+	if len(f.HDUs()) < 2 {
+		return nil, fmt.Errorf("lsst: no extension in FITS file [%s]", f.name)
+	}
+	table, ok := f.HDU(1).(*fits.Table)
+	if !ok {
+		return nil, fmt.Errorf("lsst: first extension of FITS file [%s] is not a table", f.name)
+	}
+	return table, nil
+}
+
+// Close closes the FITS file and the underlying OS file.
+func (f *FitsFile) Close() error {
+	err := f.File.Close()
+	if e := f.close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// close closes the decompressor and the OS file.
+func (f *FitsFile) close() error {
+	var err error
+	if f.z != nil {
+		err = f.z.Close()
+	}
+	if e := f.f.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,642 @@
+// Package healpix implements the HEALPix pixelization of the sphere,
+// in the RING and NESTED numbering schemes.
+//
+// See Gorski et al., 2005, ApJ 622, 759 and http://healpix.sourceforge.net.
+package healpix
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scheme is a HEALPix pixel numbering scheme.
+type Scheme int
+
+const (
+	Nest Scheme = iota // NESTED numbering scheme
+	Ring               // RING numbering scheme
+)
+
+func (s Scheme) String() string {
+	switch s {
+	case Nest:
+		return "nest"
+	case Ring:
+		return "ring"
+	}
+	return fmt.Sprintf("Scheme(%d)", int(s))
+}
+
+// ParseScheme returns the scheme named s ("nest" or "ring").
+// An empty name means Nest.
+func ParseScheme(s string) (Scheme, error) {
+	switch s {
+	case "", "nest", "NEST", "nested", "NESTED":
+		return Nest, nil
+	case "ring", "RING":
+		return Ring, nil
+	}
+	return Nest, fmt.Errorf("healpix: invalid scheme %q (want nest|ring)", s)
+}
+
+// MaxOrder is the maximum resolution order (NSIDE = 2^MaxOrder) supported.
+const MaxOrder = 29
+
+const (
+	twothird = 2.0 / 3.0
+	halfpi   = 0.5 * math.Pi
+	twopi    = 2 * math.Pi
+	deg2rad  = math.Pi / 180
+	rad2deg  = 180 / math.Pi
+)
+
+var (
+	// ring index (in units of nside) and phi index (in units of nr/2) of
+	// the southernmost corner of each base face.
+	jrll = [12]int64{2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4}
+	jpll = [12]int64{1, 3, 5, 7, 0, 2, 4, 6, 1, 3, 5, 7}
+)
+
+// Pointing is a direction on the sphere, in radians.
+type Pointing struct {
+	Theta float64 // colatitude, in [0, pi]
+	Phi   float64 // longitude, in [0, 2pi)
+}
+
+// Healpix is a HEALPix pixelization of the sphere at a given resolution.
+type Healpix struct {
+	order  uint
+	nside  int64
+	npface int64
+	ncap   int64
+	npix   int64
+	fact1  float64
+	fact2  float64
+	scheme Scheme
+}
+
+// New creates a new HEALPix pixelization with nside pixels along the side
+// of each base face. nside must be a power of 2.
+func New(nside int, scheme Scheme) (*Healpix, error) {
+	if nside < 1 || nside&(nside-1) != 0 || nside > 1<<MaxOrder {
+		return nil, fmt.Errorf("healpix: invalid nside=%d (want a power of 2 <= 2^%d)", nside, MaxOrder)
+	}
+	if scheme != Nest && scheme != Ring {
+		return nil, fmt.Errorf("healpix: invalid scheme %v", scheme)
+	}
+
+	var order uint
+	for 1<<order < nside {
+		order++
+	}
+
+	h := &Healpix{
+		order:  order,
+		nside:  int64(nside),
+		npface: int64(nside) * int64(nside),
+		scheme: scheme,
+	}
+	h.ncap = 2 * (h.npface - h.nside)
+	h.npix = 12 * h.npface
+	h.fact2 = 4.0 / float64(h.npix)
+	h.fact1 = float64(2*h.nside) * h.fact2
+	return h, nil
+}
+
+// NSide returns the number of pixels along the side of each base face.
+func (h *Healpix) NSide() int { return int(h.nside) }
+
+// NPix returns the total number of pixels.
+func (h *Healpix) NPix() int64 { return h.npix }
+
+// Scheme returns the numbering scheme of the pixelization.
+func (h *Healpix) Scheme() Scheme { return h.scheme }
+
+// PixArea returns the area of a pixel, in steradians.
+func (h *Healpix) PixArea() float64 { return 4 * math.Pi / float64(h.npix) }
+
+// Ang2Pix returns the pixel holding the direction (theta, phi), in radians.
+func (h *Healpix) Ang2Pix(theta, phi float64) int64 {
+	z := math.Cos(theta)
+	if theta < 0.01 || theta > math.Pi-0.01 {
+		return h.loc2pix(z, phi, math.Sin(theta), true)
+	}
+	return h.loc2pix(z, phi, 0, false)
+}
+
+// Pix2Ang returns the direction (theta, phi), in radians, of the center of pixel pix.
+func (h *Healpix) Pix2Ang(pix int64) (theta, phi float64) {
+	z, phi, sth, haveSth := h.pix2loc(pix)
+	if haveSth {
+		return math.Atan2(sth, z), phi
+	}
+	return math.Acos(z), phi
+}
+
+// RaDec2Pix returns the pixel holding the direction (ra, dec), in degrees.
+func (h *Healpix) RaDec2Pix(ra, dec float64) int64 {
+	return h.Ang2Pix((90-dec)*deg2rad, ra*deg2rad)
+}
+
+// Pix2RaDec returns the direction (ra, dec), in degrees, of the center of pixel pix.
+func (h *Healpix) Pix2RaDec(pix int64) (ra, dec float64) {
+	theta, phi := h.Pix2Ang(pix)
+	return phi * rad2deg, 90 - theta*rad2deg
+}
+
+// Nest2Ring converts a NESTED pixel index to its RING index.
+func (h *Healpix) Nest2Ring(pix int64) int64 {
+	ix, iy, face := h.nest2xyf(pix)
+	return h.xyf2ring(ix, iy, face)
+}
+
+// Ring2Nest converts a RING pixel index to its NESTED index.
+func (h *Healpix) Ring2Nest(pix int64) int64 {
+	ix, iy, face := h.ring2xyf(pix)
+	return h.xyf2nest(ix, iy, face)
+}
+
+var (
+	nbXOffset = [8]int64{-1, -1, 0, 1, 1, 1, 0, -1}
+	nbYOffset = [8]int64{0, 1, 1, 1, 0, -1, -1, -1}
+
+	nbFaceArray = [9][12]int64{
+		{8, 9, 10, 11, -1, -1, -1, -1, 10, 11, 8, 9}, // S
+		{5, 6, 7, 4, 8, 9, 10, 11, 9, 10, 11, 8},     // SE
+		{-1, -1, -1, -1, 5, 6, 7, 4, -1, -1, -1, -1}, // E
+		{4, 5, 6, 7, 11, 8, 9, 10, 11, 8, 9, 10},     // SW
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},       // center
+		{1, 2, 3, 0, 0, 1, 2, 3, 5, 6, 7, 4},         // NE
+		{-1, -1, -1, -1, 7, 4, 5, 6, -1, -1, -1, -1}, // W
+		{3, 0, 1, 2, 3, 0, 1, 2, 4, 5, 6, 7},         // NW
+		{2, 3, 0, 1, -1, -1, -1, -1, 0, 1, 2, 3},     // N
+	}
+
+	nbSwapArray = [9][3]int64{
+		{0, 0, 3}, // S
+		{0, 0, 6}, // SE
+		{0, 0, 0}, // E
+		{0, 0, 5}, // SW
+		{0, 0, 0}, // center
+		{5, 0, 0}, // NE
+		{0, 0, 0}, // W
+		{6, 0, 0}, // NW
+		{3, 0, 0}, // N
+	}
+)
+
+// Neighbours returns the 8 neighbours of pixel pix, in the order
+// SW, W, NW, N, NE, E, SE, S.
+// A missing neighbour (only possible for the W, N, E and S directions)
+// is reported as -1.
+func (h *Healpix) Neighbours(pix int64) [8]int64 {
+	var nbs [8]int64
+	ix, iy, face := h.pix2xyf(pix)
+
+	nsm1 := h.nside - 1
+	if ix > 0 && ix < nsm1 && iy > 0 && iy < nsm1 {
+		for i := range nbs {
+			nbs[i] = h.xyf2pix(ix+nbXOffset[i], iy+nbYOffset[i], face)
+		}
+		return nbs
+	}
+
+	for i := range nbs {
+		x := ix + nbXOffset[i]
+		y := iy + nbYOffset[i]
+		nbnum := 4
+		switch {
+		case x < 0:
+			x += h.nside
+			nbnum--
+		case x >= h.nside:
+			x -= h.nside
+			nbnum++
+		}
+		switch {
+		case y < 0:
+			y += h.nside
+			nbnum -= 3
+		case y >= h.nside:
+			y -= h.nside
+			nbnum += 3
+		}
+
+		f := nbFaceArray[nbnum][face]
+		if f < 0 {
+			nbs[i] = -1
+			continue
+		}
+
+		bits := nbSwapArray[nbnum][face>>2]
+		if bits&1 != 0 {
+			x = h.nside - x - 1
+		}
+		if bits&2 != 0 {
+			y = h.nside - y - 1
+		}
+		if bits&4 != 0 {
+			x, y = y, x
+		}
+		nbs[i] = h.xyf2pix(x, y, f)
+	}
+	return nbs
+}
+
+// Boundaries returns 4*step points along the boundary of pixel pix.
+// The first point is the northernmost corner of the pixel, the following
+// ones go along the boundary through the west, south and east corners.
+// step=1 returns the 4 corners of the pixel.
+func (h *Healpix) Boundaries(pix int64, step int) []Pointing {
+	if step < 1 {
+		step = 1
+	}
+	ix, iy, face := h.pix2xyf(pix)
+
+	var (
+		ns  = float64(h.nside)
+		dc  = 0.5 / ns
+		xc  = (float64(ix) + 0.5) / ns
+		yc  = (float64(iy) + 0.5) / ns
+		d   = 1.0 / (float64(step) * ns)
+		pts = make([]Pointing, 4*step)
+	)
+
+	for i := 0; i < step; i++ {
+		fi := float64(i)
+		pts[i] = xyf2ang(xc+dc-fi*d, yc+dc, face)
+		pts[i+step] = xyf2ang(xc-dc, yc+dc-fi*d, face)
+		pts[i+2*step] = xyf2ang(xc-dc+fi*d, yc-dc, face)
+		pts[i+3*step] = xyf2ang(xc+dc, yc-dc+fi*d, face)
+	}
+	return pts
+}
+
+// xyf2ang returns the direction of the point with continuous coordinates
+// (x,y) in [0,1] on the base face.
+func xyf2ang(x, y float64, face int64) Pointing {
+	var (
+		jr  = float64(jrll[face]) - x - y
+		nr  float64
+		z   float64
+		sth float64
+		pt  Pointing
+	)
+
+	switch {
+	case jr < 1:
+		nr = jr
+		tmp := nr * nr / 3
+		z = 1 - tmp
+		sth = math.Sqrt(tmp * (2 - tmp))
+	case jr > 3:
+		nr = 4 - jr
+		tmp := nr * nr / 3
+		z = tmp - 1
+		sth = math.Sqrt(tmp * (2 - tmp))
+	default:
+		nr = 1
+		z = (2 - jr) * 2 / 3
+		sth = math.Sqrt((1 - z) * (1 + z))
+	}
+
+	tmp := float64(jpll[face])*nr + x - y
+	if tmp < 0 {
+		tmp += 8
+	}
+	if tmp >= 8 {
+		tmp -= 8
+	}
+
+	pt.Theta = math.Atan2(sth, z)
+	if nr > 1e-15 {
+		pt.Phi = 0.5 * halfpi * tmp / nr
+	}
+	return pt
+}
+
+func (h *Healpix) loc2pix(z, phi, sth float64, haveSth bool) int64 {
+	za := math.Abs(z)
+	tt := math.Mod(phi*(1/halfpi), 4) // in [0,4)
+	if tt < 0 {
+		tt += 4
+	}
+
+	if h.scheme == Ring {
+		if za <= twothird { // equatorial region
+			nl4 := 4 * h.nside
+			temp1 := float64(h.nside) * (0.5 + tt)
+			temp2 := float64(h.nside) * z * 0.75
+			jp := int64(temp1 - temp2) // index of ascending edge line
+			jm := int64(temp1 + temp2) // index of descending edge line
+
+			// ring number counted from z=2/3
+			ir := h.nside + 1 + jp - jm // in {1,2n+1}
+			kshift := 1 - (ir & 1)      // kshift=1 if ir even, 0 otherwise
+
+			t1 := jp + jm - h.nside + kshift + 1 + nl4 + nl4
+			ip := (t1 >> 1) & (nl4 - 1)
+
+			return h.ncap + (ir-1)*nl4 + ip
+		}
+
+		// north & south polar caps
+		tp := tt - math.Floor(tt)
+		var tmp float64
+		if za < 0.99 || !haveSth {
+			tmp = float64(h.nside) * math.Sqrt(3*(1-za))
+		} else {
+			tmp = float64(h.nside) * sth / math.Sqrt((1+za)/3)
+		}
+
+		jp := int64(tp * tmp)       // increasing edge line index
+		jm := int64((1 - tp) * tmp) // decreasing edge line index
+
+		ir := jp + jm + 1             // ring number counted from the closest pole
+		ip := int64(tt * float64(ir)) // in {0,4*ir-1}
+		if ip >= 4*ir {
+			ip -= 4 * ir
+		}
+
+		if z > 0 {
+			return 2*ir*(ir-1) + ip
+		}
+		return h.npix - 2*ir*(ir+1) + ip
+	}
+
+	// NEST scheme
+	if za <= twothird { // equatorial region
+		temp1 := float64(h.nside) * (0.5 + tt)
+		temp2 := float64(h.nside) * (z * 0.75)
+		jp := int64(temp1 - temp2) // index of ascending edge line
+		jm := int64(temp1 + temp2) // index of descending edge line
+		ifp := jp >> h.order       // in {0,4}
+		ifm := jm >> h.order
+
+		var face int64
+		switch {
+		case ifp == ifm:
+			face = ifp | 4
+		case ifp < ifm:
+			face = ifp
+		default:
+			face = ifm + 8
+		}
+
+		ix := jm & (h.nside - 1)
+		iy := h.nside - (jp & (h.nside - 1)) - 1
+		return h.xyf2nest(ix, iy, face)
+	}
+
+	// polar region, za > 2/3
+	ntt := int64(tt)
+	if ntt > 3 {
+		ntt = 3
+	}
+	tp := tt - float64(ntt)
+	var tmp float64
+	if za < 0.99 || !haveSth {
+		tmp = float64(h.nside) * math.Sqrt(3*(1-za))
+	} else {
+		tmp = float64(h.nside) * sth / math.Sqrt((1+za)/3)
+	}
+
+	jp := int64(tp * tmp)       // increasing edge line index
+	jm := int64((1 - tp) * tmp) // decreasing edge line index
+	if jp > h.nside-1 {
+		jp = h.nside - 1
+	}
+	if jm > h.nside-1 {
+		jm = h.nside - 1
+	}
+
+	if z >= 0 {
+		return h.xyf2nest(h.nside-jm-1, h.nside-jp-1, ntt)
+	}
+	return h.xyf2nest(jp, jm, ntt+8)
+}
+
+func (h *Healpix) pix2loc(pix int64) (z, phi, sth float64, haveSth bool) {
+	if h.scheme == Ring {
+		switch {
+		case pix < h.ncap: // north polar cap
+			iring := (1 + isqrt(1+2*pix)) >> 1 // counted from north pole
+			iphi := (pix + 1) - 2*iring*(iring-1)
+
+			tmp := float64(iring*iring) * h.fact2
+			z = 1 - tmp
+			if z > 0.99 {
+				sth = math.Sqrt(tmp * (2 - tmp))
+				haveSth = true
+			}
+			phi = (float64(iphi) - 0.5) * halfpi / float64(iring)
+
+		case pix < h.npix-h.ncap: // equatorial region
+			nl4 := 4 * h.nside
+			ip := pix - h.ncap
+			tmp := ip >> (h.order + 2)
+			iring := tmp + h.nside
+			iphi := ip - nl4*tmp + 1
+			fodd := 0.5
+			if (iring+h.nside)&1 != 0 {
+				fodd = 1
+			}
+			z = float64(2*h.nside-iring) * h.fact1
+			phi = (float64(iphi) - fodd) * math.Pi * 0.75 * h.fact1
+
+		default: // south polar cap
+			ip := h.npix - pix
+			iring := (1 + isqrt(2*ip-1)) >> 1 // counted from south pole
+			iphi := 4*iring + 1 - (ip - 2*iring*(iring-1))
+
+			tmp := float64(iring*iring) * h.fact2
+			z = tmp - 1
+			if z < -0.99 {
+				sth = math.Sqrt(tmp * (2 - tmp))
+				haveSth = true
+			}
+			phi = (float64(iphi) - 0.5) * halfpi / float64(iring)
+		}
+		return z, phi, sth, haveSth
+	}
+
+	// NEST scheme
+	nl4 := 4 * h.nside
+	ix, iy, face := h.nest2xyf(pix)
+
+	jr := (jrll[face] << h.order) - ix - iy - 1
+
+	var nr, kshift int64
+	switch {
+	case jr < h.nside:
+		nr = jr
+		tmp := float64(nr*nr) * h.fact2
+		z = 1 - tmp
+		if z > 0.99 {
+			sth = math.Sqrt(tmp * (2 - tmp))
+			haveSth = true
+		}
+	case jr > 3*h.nside:
+		nr = nl4 - jr
+		tmp := float64(nr*nr) * h.fact2
+		z = tmp - 1
+		if z < -0.99 {
+			sth = math.Sqrt(tmp * (2 - tmp))
+			haveSth = true
+		}
+	default:
+		nr = h.nside
+		z = float64(2*h.nside-jr) * h.fact1
+		kshift = (jr - h.nside) & 1
+	}
+
+	jp := (jpll[face]*nr + ix - iy + 1 + kshift) / 2
+	if jp > nl4 {
+		jp -= nl4
+	}
+	if jp < 1 {
+		jp += nl4
+	}
+
+	phi = (float64(jp) - float64(kshift+1)*0.5) * (halfpi / float64(nr))
+	return z, phi, sth, haveSth
+}
+
+func (h *Healpix) xyf2pix(ix, iy, face int64) int64 {
+	if h.scheme == Ring {
+		return h.xyf2ring(ix, iy, face)
+	}
+	return h.xyf2nest(ix, iy, face)
+}
+
+func (h *Healpix) pix2xyf(pix int64) (ix, iy, face int64) {
+	if h.scheme == Ring {
+		return h.ring2xyf(pix)
+	}
+	return h.nest2xyf(pix)
+}
+
+func (h *Healpix) xyf2nest(ix, iy, face int64) int64 {
+	return face<<(2*h.order) + spreadBits(ix) + spreadBits(iy)<<1
+}
+
+func (h *Healpix) nest2xyf(pix int64) (ix, iy, face int64) {
+	face = pix >> (2 * h.order)
+	pix &= h.npface - 1
+	ix = compressBits(pix)
+	iy = compressBits(pix >> 1)
+	return ix, iy, face
+}
+
+func (h *Healpix) xyf2ring(ix, iy, face int64) int64 {
+	nl4 := 4 * h.nside
+	jr := jrll[face]*h.nside - ix - iy - 1
+
+	var nr, nbefore, kshift int64
+	switch {
+	case jr < h.nside:
+		nr = jr
+		nbefore = 2 * nr * (nr - 1)
+	case jr > 3*h.nside:
+		nr = nl4 - jr
+		nbefore = h.npix - 2*(nr+1)*nr
+	default:
+		nr = h.nside
+		nbefore = h.ncap + (jr-h.nside)*nl4
+		kshift = (jr - h.nside) & 1
+	}
+
+	jp := (jpll[face]*nr + ix - iy + 1 + kshift) / 2
+	switch {
+	case jp > nl4:
+		jp -= nl4
+	case jp < 1:
+		jp += nl4
+	}
+
+	return nbefore + jp - 1
+}
+
+func (h *Healpix) ring2xyf(pix int64) (ix, iy, face int64) {
+	var (
+		nl2                 = 2 * h.nside
+		iring, iphi, kshift int64
+		nr                  int64
+	)
+
+	switch {
+	case pix < h.ncap: // north polar cap
+		iring = (1 + isqrt(1+2*pix)) >> 1
+		iphi = (pix + 1) - 2*iring*(iring-1)
+		nr = iring
+		face = (iphi - 1) / nr
+
+	case pix < h.npix-h.ncap: // equatorial region
+		ip := pix - h.ncap
+		tmp := ip >> (h.order + 2)
+		iring = tmp + h.nside
+		iphi = ip - tmp*4*h.nside + 1
+		kshift = (iring + h.nside) & 1
+		nr = h.nside
+		ire := tmp + 1
+		irm := nl2 + 2 - ire
+		ifm := (iphi - ire/2 + h.nside - 1) >> h.order
+		ifp := (iphi - irm/2 + h.nside - 1) >> h.order
+		switch {
+		case ifp == ifm:
+			face = ifp | 4
+		case ifp < ifm:
+			face = ifp
+		default:
+			face = ifm + 8
+		}
+
+	default: // south polar cap
+		ip := h.npix - pix
+		iring = (1 + isqrt(2*ip-1)) >> 1
+		iphi = 4*iring + 1 - (ip - 2*iring*(iring-1))
+		nr = iring
+		iring = 2*nl2 - iring
+		face = (iphi-1)/nr + 8
+	}
+
+	irt := iring - jrll[face]*h.nside + 1
+	ipt := 2*iphi - jpll[face]*nr - kshift - 1
+	if ipt >= nl2 {
+		ipt -= 8 * h.nside
+	}
+
+	ix = (ipt - irt) >> 1
+	iy = (-ipt - irt) >> 1
+	return ix, iy, face
+}
+
+// isqrt returns the integer square root of v.
+func isqrt(v int64) int64 {
+	r := int64(math.Sqrt(float64(v) + 0.5))
+	for r*r > v {
+		r--
+	}
+	for (r+1)*(r+1) <= v {
+		r++
+	}
+	return r
+}
+
+// spreadBits spreads the bits of v: bit i of v becomes bit 2i of the result.
+func spreadBits(v int64) int64 {
+	var r int64
+	for i := uint(0); i < 32; i++ {
+		r |= (v >> i & 1) << (2 * i)
+	}
+	return r
+}
+
+// compressBits compresses the bits of v: bit 2i of v becomes bit i of the result.
+func compressBits(v int64) int64 {
+	var r int64
+	for i := uint(0); i < 32; i++ {
+		r |= (v >> (2 * i) & 1) << i
+	}
+	return r
+}
@@ -0,0 +1,110 @@
+package healpix
+
+import (
+	"math"
+	"testing"
+)
+
+// angdist returns the angular distance between two pointings, in radians.
+func angdist(t1, p1, t2, p2 float64) float64 {
+	c := math.Cos(t1)*math.Cos(t2) + math.Sin(t1)*math.Sin(t2)*math.Cos(p1-p2)
+	return math.Acos(math.Min(1, c))
+}
+
+func TestNest2Ring(t *testing.T) {
+	for _, tc := range []struct {
+		nside int
+		nest  int64
+		ring  int64
+	}{
+		{nside: 1, nest: 0, ring: 0},
+		{nside: 1, nest: 4, ring: 4},
+		{nside: 1, nest: 11, ring: 11},
+		{nside: 2, nest: 0, ring: 13},
+		{nside: 2, nest: 1, ring: 5},
+		{nside: 2, nest: 2, ring: 4},
+		{nside: 2, nest: 3, ring: 0},
+		{nside: 2, nest: 4, ring: 15},
+		{nside: 2, nest: 5, ring: 7},
+		{nside: 2, nest: 6, ring: 6},
+		{nside: 2, nest: 7, ring: 1},
+		{nside: 2, nest: 8, ring: 17},
+		{nside: 2, nest: 9, ring: 9},
+		{nside: 16, nest: 1130, ring: 1504},
+	} {
+		h, err := New(tc.nside, Nest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := h.Nest2Ring(tc.nest); got != tc.ring {
+			t.Errorf("nside=%d: Nest2Ring(%d) = %d (want=%d)", tc.nside, tc.nest, got, tc.ring)
+		}
+		if got := h.Ring2Nest(tc.ring); got != tc.nest {
+			t.Errorf("nside=%d: Ring2Nest(%d) = %d (want=%d)", tc.nside, tc.ring, got, tc.nest)
+		}
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	for _, nside := range []int{1, 2, 4, 8, 16, 64} {
+		nest, err := New(nside, Nest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring, err := New(nside, Ring)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := make(map[int64]bool, nest.NPix())
+		for p := int64(0); p < nest.NPix(); p++ {
+			q := nest.Nest2Ring(p)
+			if q < 0 || q >= nest.NPix() || seen[q] {
+				t.Fatalf("nside=%d: Nest2Ring(%d) = %d is not a permutation", nside, p, q)
+			}
+			seen[q] = true
+			if r := nest.Ring2Nest(q); r != p {
+				t.Fatalf("nside=%d: Ring2Nest(Nest2Ring(%d)) = %d", nside, p, r)
+			}
+
+			// both pixels have the same center.
+			th1, ph1 := nest.Pix2Ang(p)
+			th2, ph2 := ring.Pix2Ang(q)
+			if d := angdist(th1, ph1, th2, ph2); d > 1e-6 {
+				t.Fatalf("nside=%d: nest pixel %d and ring pixel %d are %v rad apart", nside, p, q, d)
+			}
+
+			for _, h := range []*Healpix{nest, ring} {
+				pix := p
+				if h == ring {
+					pix = q
+				}
+				th, ph := h.Pix2Ang(pix)
+				if got := h.Ang2Pix(th, ph); got != pix {
+					t.Fatalf("nside=%d %v: Ang2Pix(Pix2Ang(%d)) = %d", nside, h.Scheme(), pix, got)
+				}
+			}
+		}
+	}
+}
+
+func TestAng2Pix(t *testing.T) {
+	h, err := New(16, Ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		theta, phi float64
+		pix        int64
+	}{
+		{theta: math.Pi / 2, phi: 0, pix: 1440},
+		{theta: math.Pi / 4, phi: math.Pi / 4, pix: 427},
+		{theta: math.Pi / 2, phi: math.Pi / 2, pix: 1520},
+		{theta: 0, phi: 0, pix: 0},
+		{theta: math.Pi, phi: 0, pix: 3068},
+	} {
+		if got := h.Ang2Pix(tc.theta, tc.phi); got != tc.pix {
+			t.Errorf("Ang2Pix(%v, %v) = %d (want=%d)", tc.theta, tc.phi, got, tc.pix)
+		}
+	}
+}
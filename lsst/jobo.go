@@ -0,0 +1,249 @@
+package lsst
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gonuts/toml"
+)
+
+// LoadJobo decodes the job options file fname.
+// Keys of fname which do not match any option are reported as an error.
+func LoadJobo(fname string) (FileOptions, error) {
+	var jobo FileOptions
+	md, err := toml.DecodeFile(fname, &jobo)
+	if err != nil {
+		return jobo, err
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		return jobo, fmt.Errorf("lsst: unknown keys in jobo [%s]: %s", fname, strings.Join(keys, ", "))
+	}
+
+	return jobo, err
+}
+
+// ReadJobo decodes and validates the job options file fname, writing
+// a report of the problems found to w.
+func ReadJobo(w io.Writer, fname string) (FileOptions, error) {
+	jobo, err := LoadJobo(fname)
+	if err != nil {
+		fmt.Fprintf(w, "jobo [%s]: %v\n", fname, err)
+		return jobo, err
+	}
+
+	errs := jobo.Validate()
+	if len(errs) == 0 {
+		fmt.Fprintf(w, "jobo [%s]: OK\n", fname)
+		return jobo, nil
+	}
+
+	fmt.Fprintf(w, "jobo [%s]:\n", fname)
+	for _, err := range errs {
+		fmt.Fprintf(w, " - %v\n", err)
+	}
+	fmt.Fprintf(w, "jobo [%s]: %d error(s)\n", fname, len(errs))
+
+	return jobo, fmt.Errorf("lsst: invalid jobo [%s]", fname)
+}
+
+// Validate checks the consistency of the job options and returns the
+// problems found.
+func (cfg FileOptions) Validate() []error {
+	var errs []error
+	errorf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// input files
+	modes := 0
+	for _, ok := range []bool{
+		cfg.RunFMMs != nil,
+		cfg.RunFCCs != nil,
+		cfg.FileList != "",
+		len(cfg.Globs) > 0 || cfg.Walk,
+	} {
+		if ok {
+			modes++
+		}
+	}
+	switch modes {
+	case 0:
+		errorf("no input files (one needs either RunFMMs, RunFCCs, FileList, Globs or Walk)")
+	case 1:
+	default:
+		errorf("several input modes (one needs only one of RunFMMs, RunFCCs, FileList, Globs or Walk)")
+	}
+
+	for _, r := range cfg.RunFMMs {
+		if r.Run <= 0 {
+			errorf("RunFMMs: invalid run %d", r.Run)
+		}
+		if r.FieldMin < 0 || r.FieldMin > r.FieldMax {
+			errorf("RunFMMs[run=%d]: invalid field range [%d, %d]", r.Run, r.FieldMin, r.FieldMax)
+		}
+	}
+	for _, r := range cfg.RunFCCs {
+		if r.Run <= 0 {
+			errorf("RunFCCs: invalid run %d", r.Run)
+		}
+		if r.Field < 0 {
+			errorf("RunFCCs[run=%d]: invalid field %d", r.Run, r.Field)
+		}
+	}
+	if cfg.RunFCCs != nil && len(cfg.Filters) == 0 {
+		errorf("Filters: missing (needed by RunFCCs)")
+	}
+	// BaseDir is only optional for file lists of absolute paths.
+	needBaseDir := true
+	if cfg.FileList != "" {
+		need, err := fileListNeedsBaseDir(cfg.FileList)
+		if err != nil {
+			errorf("FileList: %v", err)
+		}
+		needBaseDir = need || err != nil
+	}
+	if needBaseDir {
+		switch fi, err := os.Stat(cfg.BaseDir); {
+		case cfg.BaseDir == "":
+			errorf("BaseDir: missing")
+		case err != nil:
+			errorf("BaseDir: %v", err)
+		case !fi.IsDir():
+			errorf("BaseDir: [%s] is not a directory", cfg.BaseDir)
+		}
+	}
+
+	if _, err := NewLayout(cfg.BaseDir, cfg.PathTemplate); err != nil {
+		errorf("PathTemplate: %v", err)
+	}
+	if _, err := NewNameParser(cfg.BaseDir, cfg.NamePattern); err != nil {
+		errorf("NamePattern: %v", err)
+	}
+
+	fs, err := LookupFilterSet(cfg.FilterSet)
+	if err != nil {
+		errorf("FilterSet: %v", err)
+	} else {
+		errs = append(errs, cfg.checkFilters(fs)...)
+	}
+
+	if !cfg.RaDec.isZero() {
+		for _, err := range cfg.RaDec.check() {
+			errorf("RaDec: %v", err)
+		}
+	}
+
+	for i, r := range cfg.Regions {
+		if _, err := r.New(); err != nil {
+			errorf("Regions[%d]: %v", i, err)
+		}
+	}
+
+	if _, err := NewEpochs(cfg.Epoch); err != nil {
+		errorf("Epoch: %v", err)
+	}
+
+	if cfg.Mags.Enable && !cfg.Mags.FluxMag0 && len(cfg.Mags.ZeroPoints) == 0 {
+		errorf("Mags: missing ZeroPoints (or FluxMag0)")
+	}
+
+	if cfg.Robust.NSigma < 0 {
+		errorf("Robust.NSigma: invalid value %v", cfg.Robust.NSigma)
+	}
+	if cfg.Robust.MaxIter < 0 {
+		errorf("Robust.MaxIter: invalid value %d", cfg.Robust.MaxIter)
+	}
+	if cfg.Robust.MaxSamples < 0 {
+		errorf("Robust.MaxSamples: invalid value %d", cfg.Robust.MaxSamples)
+	}
+	if cfg.Robust.Partitions < 0 {
+		errorf("Robust.Partitions: invalid value %d", cfg.Robust.Partitions)
+	}
+	if cfg.LightCurves.MaxSamples < 0 {
+		errorf("LightCurves.MaxSamples: invalid value %d", cfg.LightCurves.MaxSamples)
+	}
+	if cfg.LightCurves.Partitions < 0 {
+		errorf("LightCurves.Partitions: invalid value %d", cfg.LightCurves.Partitions)
+	}
+
+	if _, err := ParseAssocMode(cfg.Association.Mode); err != nil {
+		errorf("Association.Mode: %v", err)
+	}
+	if cfg.Association.MatchRadius < 0 {
+		errorf("Association.MatchRadius: invalid value %v", cfg.Association.MatchRadius)
+	}
+
+	if cfg.Variability.MinN < 0 {
+		errorf("Variability.MinN: invalid value %d", cfg.Variability.MinN)
+	}
+	if cfg.Variability.Eta < 0 {
+		errorf("Variability.Eta: invalid value %v", cfg.Variability.Eta)
+	}
+	if cfg.Variability.Amplitude < 0 {
+		errorf("Variability.Amplitude: invalid value %v", cfg.Variability.Amplitude)
+	}
+
+	if _, err := cfg.Healpix.New(); err != nil {
+		errorf("Healpix: %v", err)
+	}
+
+	if cfg.Flux != [2]float64{} && cfg.Flux[0] >= cfg.Flux[1] {
+		errorf("Flux: empty range [%v, %v]", cfg.Flux[0], cfg.Flux[1])
+	}
+	if cfg.Mags.Enable && cfg.Mags.FluxMag0 && cfg.Flux == [2]float64{} {
+		errorf("Flux: missing (Mags.FluxMag0 needs a window in nJy, the default one is in file units)")
+	}
+
+	errs = append(errs, cfg.Selection.check()...)
+	if cfg.Selection.NeedMags() && !cfg.Mags.Enable {
+		errorf("Selection: magnitude and color cuts need Mags.Enable")
+	}
+
+	if cfg.NWorkers < 0 {
+		errorf("NWorkers: invalid value %d", cfg.NWorkers)
+	}
+	if cfg.Checkpoint < 0 {
+		errorf("Checkpoint: invalid value %d", cfg.Checkpoint)
+	}
+	if _, err := ParseErrPolicy(cfg.OnError); err != nil {
+		errorf("OnError: %v", err)
+	}
+	if cfg.MaxBadFiles < 0 {
+		errorf("MaxBadFiles: invalid value %d", cfg.MaxBadFiles)
+	}
+
+	return errs
+}
+
+// check checks the consistency of the limits and binning of a region.
+func (lim RaDecLim) check() []error {
+	// lim is a copy: normalizing it does not modify the options.
+	var errs []error
+	errorf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if err := lim.Normalize(); err != nil {
+		errorf("%v", err)
+	}
+
+	for _, v := range []RaDec{lim.Min, lim.Max} {
+		if v.Ra < 0 || v.Ra > 360 {
+			errorf("ra=%v out of [0, 360]", v.Ra)
+		}
+		if v.Dec < -90 || v.Dec > 90 {
+			errorf("dec=%v out of [-90, 90]", v.Dec)
+		}
+	}
+
+	return errs
+}
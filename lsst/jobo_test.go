@@ -0,0 +1,77 @@
+package lsst
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRaDec(t *testing.T) {
+	// the RaDec section of the jobos shipped before validation: the
+	// declination range [-90, -90] is empty.
+	jobo := func(maxDec float64) FileOptions {
+		return FileOptions{
+			BaseDir: t.TempDir(),
+			Filters: []string{"i"},
+			RaDec: RaDecLim{
+				Min:      RaDec{Ra: 0, Dec: -90},
+				Max:      RaDec{Ra: 360, Dec: maxDec},
+				NbRa:     36,
+				NbDec:    18,
+				DeltaRa:  10,
+				DeltaDec: 10,
+			},
+			RunFMMs: []RunFieldMinMax{{Run: 1752, FieldMin: 30, FieldMax: 230}},
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		maxDec float64
+		want   string // expected RaDec error (empty: none)
+	}{
+		{name: "empty-dec-range", maxDec: -90, want: "RaDec: lsst: empty dec range [-90, -90]"},
+		{name: "full-sky", maxDec: 90},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, err := range jobo(tc.maxDec).Validate() {
+				if strings.HasPrefix(err.Error(), "RaDec:") {
+					got = append(got, err.Error())
+				}
+			}
+			switch {
+			case tc.want == "" && len(got) != 0:
+				t.Fatalf("unexpected RaDec errors: %q", got)
+			case tc.want != "" && (len(got) != 1 || got[0] != tc.want):
+				t.Fatalf("got RaDec errors %q (want=%q)", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateFluxMag0(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		flux [2]float64
+		want bool // whether a Flux error is expected
+	}{
+		{name: "default-window", want: true},
+		{name: "njy-window", flux: [2]float64{0, 1e7}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			jobo := FileOptions{
+				Flux: tc.flux,
+				Mags: MagOptions{Enable: true, FluxMag0: true},
+			}
+			got := false
+			for _, err := range jobo.Validate() {
+				if strings.HasPrefix(err.Error(), "Flux:") {
+					got = true
+				}
+			}
+			if got != tc.want {
+				t.Fatalf("Flux error: %v (want=%v)", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package lsst
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"text/template"
+)
+
+// DefaultPathTemplate is the layout of the DC_2013 forced-photometry files,
+// relative to the base directory.
+const DefaultPathTemplate = `{{.Run}}/{{.CamCol}}/{{.Filter}}/forcedsources-{{printf "%06d" .Run}}-{{.Filter}}{{.CamCol}}-{{printf "%04d" .Field}}.fits`
+
+// Layout builds the paths of input files from their run, field, camcol and filter.
+//
+// A layout is described by a Go text/template, executed with a value
+// holding the .Run, .Field and .CamCol integers and the .Filter string.
+type Layout struct {
+	BaseDir string
+	tmpl    *template.Template
+}
+
+// pathData is the value a path template is executed with.
+type pathData struct {
+	Run    int
+	Field  int
+	CamCol int
+	Filter string
+}
+
+// NewLayout creates a new layout of files under basedir.
+// An empty text means DefaultPathTemplate.
+func NewLayout(basedir, text string) (*Layout, error) {
+	if text == "" {
+		text = DefaultPathTemplate
+	}
+
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("lsst: invalid path template: %v", err)
+	}
+
+	layout := &Layout{
+		BaseDir: basedir,
+		tmpl:    tmpl,
+	}
+
+	// make sure the template only refers to known fields
+	_, err = layout.Path(1, 1, 1, 'r')
+	if err != nil {
+		return nil, err
+	}
+
+	return layout, err
+}
+
+// Path returns the path of the file for the given run, field, camcol and filter.
+func (l *Layout) Path(run, field int, camcol, filter byte) (string, error) {
+	var buf bytes.Buffer
+	err := l.tmpl.Execute(&buf, pathData{
+		Run:    run,
+		Field:  field,
+		CamCol: int(camcol),
+		Filter: string(filter),
+	})
+	if err != nil {
+		return "", fmt.Errorf("lsst: invalid path template: %v", err)
+	}
+	return filepath.Join(l.BaseDir, buf.String()), err
+}
+
+// File returns the input file for the given run, field, camcol and filter.
+func (l *Layout) File(run, field int, camcol, filter byte) (File, error) {
+	name, err := l.Path(run, field, camcol, filter)
+	if err != nil {
+		return File{}, err
+	}
+	return File{
+		Name:   name,
+		Filter: filter,
+		CamCol: camcol,
+		Field:  field,
+		Run:    run,
+	}, err
+}
@@ -0,0 +1,97 @@
+package lsst
+
+import (
+	"fmt"
+	"math"
+)
+
+// ABZeroPoint is the zero point of AB magnitudes of fluxes in nJy:
+// a flux of 3631 Jy is an AB magnitude of 0.
+const ABZeroPoint = 31.4
+
+// DefaultFluxMag0Key is the header keyword holding the flux of a 0-magnitude
+// source in the calibrated exposures of the LSST stack.
+const DefaultFluxMag0Key = "FLUXMAG0"
+
+// FluxToMag converts a flux to a magnitude with the zero point zp.
+// FluxToMag returns NaN for a non-positive flux.
+func FluxToMag(flux, zp float64) float64 {
+	if !(flux > 0) {
+		return math.NaN()
+	}
+	return zp - 2.5*math.Log10(flux)
+}
+
+// MagToFlux converts a magnitude with the zero point zp to a flux.
+func MagToFlux(mag, zp float64) float64 {
+	return math.Pow(10, -0.4*(mag-zp))
+}
+
+// MagErr returns the magnitude error of a flux with error fluxerr.
+// MagErr returns NaN for a non-positive flux.
+func MagErr(flux, fluxerr float64) float64 {
+	if !(flux > 0) {
+		return math.NaN()
+	}
+	return 2.5 / math.Ln10 * math.Abs(fluxerr/flux)
+}
+
+// FluxMag0ToZeroPoint returns the zero point of the magnitudes of an exposure
+// from its fluxMag0, the flux of a 0-magnitude source.
+func FluxMag0ToZeroPoint(fluxMag0 float64) float64 {
+	return 2.5 * math.Log10(fluxMag0)
+}
+
+// NJyScale returns the factor converting the fluxes of an exposure with
+// the zero point zp to AB fluxes in nJy.
+func NJyScale(zp float64) float64 {
+	return math.Pow(10, 0.4*(ABZeroPoint-zp))
+}
+
+// Magnitude is a magnitude with its error.
+type Magnitude struct {
+	Mag    float64
+	MagErr float64
+}
+
+// Mag returns the magnitude of the measurements with the zero point zp.
+// The weighted mean of the measurements is used when available, the mean
+// otherwise.
+func (rec FluxRec) Mag(zp float64) Magnitude {
+	switch {
+	case rec.NW > 0:
+		return Magnitude{
+			Mag:    FluxToMag(rec.WMean(), zp),
+			MagErr: MagErr(rec.WMean(), rec.WMeanErr()),
+		}
+	case rec.N > 0:
+		return Magnitude{
+			Mag:    FluxToMag(rec.Mean(), zp),
+			MagErr: MagErr(rec.Mean(), rec.StdErr()),
+		}
+	}
+	return Magnitude{Mag: math.NaN(), MagErr: math.NaN()}
+}
+
+// Float returns the value of the floating point header keyword key,
+// looked for in the primary HDU, then in the extensions.
+func (f *FitsFile) Float(key string) (float64, error) {
+	for _, hdu := range f.HDUs() {
+		card := hdu.Header().Get(key)
+		if card == nil {
+			continue
+		}
+		switch v := card.Value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+		return 0, fmt.Errorf("lsst: header keyword %s=%v is not a number", key, card.Value)
+	}
+	return 0, fmt.Errorf("lsst: no header keyword %s", key)
+}
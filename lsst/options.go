@@ -1,14 +1,241 @@
 package lsst
 
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lsst-france/fp-ana/lsst/healpix"
+)
+
 type FileOptions struct {
 	BaseDir string
 	OutDir  string
 
-	RaDec RaDecLim
+	// PathTemplate is the layout of input files under BaseDir
+	// (default: DefaultPathTemplate)
+	PathTemplate string
+
+	RaDec RaDecLim // region and binning of the sky (see RaDecLim.Normalize)
+
+	// Regions selects the sources inside any of the regions,
+	// in place of the RaDec limits.
+	Regions []RegionOptions
+
+	// Epoch configures how the epoch of input files is found.
+	Epoch EpochOptions
+
+	// Mags converts the fluxes of each source to magnitudes (see MagOptions.)
+	Mags MagOptions
+
+	// Robust computes outlier-resistant statistics of the fluxes of
+	// each source (see RobustOptions.)
+	Robust RobustOptions
+
+	// LightCurves configures how fp-lc-bldr keeps the measurements of
+	// each object (see LightCurveOptions.)
+	LightCurves LightCurveOptions
+
+	// Association configures how measurements are associated into objects
+	// (see AssociationOptions.)
+	Association AssociationOptions
+
+	// Variability computes variability indices of the fluxes of each
+	// source and selects variable candidates (see VariabilityOptions.)
+	Variability VariabilityOptions
+
+	// Astrometry writes the mean position, positional scatter and
+	// proper motion of each source (see Astrometry.)
+	Astrometry bool
+
+	// CSV also writes the list of sources of fp-list-bldr as CSV.
+	CSV bool
+
+	// Healpix bins the RaDec region in HEALPix pixels, in place of
+	// the ra-dec cells.
+	Healpix HealpixOptions
 
 	RunFMMs []RunFieldMinMax
 	RunFCCs []RunFieldCamCol
 	Filters []string
 
+	// FilterSet names the registered filter set of the input files
+	// (sdss, lsst or cfht. default: lsst)
+	FilterSet string
+
+	// FileList is the path to a list of input files: a text file with
+	// one path per line, a FITS table with run, field and camcol_filter
+	// columns (such as fpfsum.fits) or a bad_files.json report.
+	FileList string
+
+	// Globs lists file patterns, relative to BaseDir, of the input files.
+	// Walk selects all the FITS files under BaseDir.
+	// The run, field, camcol and filter of these files are parsed
+	// from their path with NamePattern (default: DefaultNamePattern)
+	Globs       []string
+	Walk        bool
+	NamePattern string
+
+	// Flux is the window on the mean flux of the sources, in every filter
+	// (default: [0, 5e5])
 	Flux [2]float64
+
+	// Selection selects the sources written by fp-list-bldr on their
+	// fluxes, magnitudes and colors (see SelectionOptions.)
+	Selection SelectionOptions
+
+	// FluxErr is the name of the flux error column of the input files
+	// (default: DefaultFluxErr)
+	FluxErr string
+
+	NWorkers int // number of concurrent file readers (default: 1)
+
+	Checkpoint int  // number of files between checkpoints (0: no checkpoint)
+	Resume     bool // resume from the checkpoint in OutDir
+
+	OnError     string // what to do with bad files: "fail" (default) or "skip"
+	MaxBadFiles int    // with OnError="skip", abort after MaxBadFiles bad files (0: no limit)
+}
+
+// DefaultFluxErr is the name of the flux error column of the DC_2013
+// forced-photometry files.
+const DefaultFluxErr = "flux_psf_err"
+
+// MagOptions configures the conversion of the fluxes of each source to
+// magnitudes.
+//
+// With FluxMag0, the fluxes of each file are first calibrated to AB fluxes
+// in nJy with the FluxMag0Key header keyword of the file, and converted to AB
+// magnitudes. Otherwise, the fluxes are converted with the zero point of
+// their filter.
+type MagOptions struct {
+	Enable      bool
+	ZeroPoints  map[string]float64 // zero point of each filter
+	FluxMag0    bool               // calibrate the fluxes of each file with its fluxMag0
+	FluxMag0Key string             // header keyword holding fluxMag0 (default: DefaultFluxMag0Key)
+}
+
+// RobustOptions configures the outlier-resistant statistics of the fluxes
+// of each source: the median, MAD-based sigma and sigma-clipped mean and sigma.
+// These need the individual measurements of each source, which are kept in
+// memory up to MaxSamples measurements and spilled to disk beyond.
+type RobustOptions struct {
+	Enable     bool
+	NSigma     float64 // sigma-clipping threshold (default: 3)
+	MaxIter    int     // maximum number of sigma-clipping iterations (default: 5)
+	MaxSamples int     // number of measurements kept in memory (default: 10000000)
+	Partitions int     // number of files the measurements are spilled to (default: 64)
+}
+
+// WithDefaults returns the options, with default values for unset ones.
+func (o RobustOptions) WithDefaults() RobustOptions {
+	if o.NSigma == 0 {
+		o.NSigma = 3
+	}
+	if o.MaxIter == 0 {
+		o.MaxIter = 5
+	}
+	if o.MaxSamples == 0 {
+		o.MaxSamples = 10000000
+	}
+	if o.Partitions == 0 {
+		o.Partitions = 64
+	}
+	return o
+}
+
+// LightCurveOptions configures how fp-lc-bldr keeps the measurements of each
+// object: in memory up to MaxSamples measurements and spilled to disk beyond.
+type LightCurveOptions struct {
+	MaxSamples int // number of measurements kept in memory (default: 10000000)
+	Partitions int // number of files the measurements are spilled to (default: 64)
+}
+
+// WithDefaults returns the options, with default values for unset ones.
+func (o LightCurveOptions) WithDefaults() LightCurveOptions {
+	if o.MaxSamples == 0 {
+		o.MaxSamples = 10000000
+	}
+	if o.Partitions == 0 {
+		o.Partitions = 64
+	}
+	return o
+}
+
+// HealpixOptions describes a HEALPix pixelization of the sky.
+type HealpixOptions struct {
+	NSide  int    // number of pixels along the side of a base face (0: no HEALPix)
+	Scheme string // pixel numbering scheme: "nest" (default) or "ring"
+}
+
+// New returns the HEALPix pixelization described by the options,
+// or nil if NSide is 0.
+func (o HealpixOptions) New() (*healpix.Healpix, error) {
+	if o.NSide == 0 {
+		return nil, nil
+	}
+	scheme, err := healpix.ParseScheme(o.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return healpix.New(o.NSide, scheme)
+}
+
+// checkFilters checks the filters and camcols of the options are valid
+// for the filter set fs.
+func (cfg FileOptions) checkFilters(fs FilterSet) []error {
+	var errs []error
+	for _, name := range cfg.Filters {
+		if _, err := fs.Parse(name); err != nil {
+			errs = append(errs, fmt.Errorf("Filters: %v", err))
+		}
+	}
+
+	for _, r := range cfg.RunFMMs {
+		for _, name := range r.Filters {
+			if _, err := fs.Parse(name); err != nil {
+				errs = append(errs, fmt.Errorf("RunFMMs[run=%d].Filters: %v", r.Run, err))
+			}
+		}
+		for _, cc := range r.CamCols {
+			if _, err := CamColIndex(byte(cc)); err != nil {
+				errs = append(errs, fmt.Errorf("RunFMMs[run=%d].CamCols: %v", r.Run, err))
+			}
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Mags.ZeroPoints))
+	for name := range cfg.Mags.ZeroPoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fs.Parse(name); err != nil {
+			errs = append(errs, fmt.Errorf("Mags.ZeroPoints: %v", err))
+		}
+	}
+
+	for _, name := range cfg.Selection.names() {
+		if _, err := fs.Parse(name); err != nil {
+			errs = append(errs, fmt.Errorf("Selection.Filters: %v", err))
+		}
+	}
+	for i, cut := range cfg.Selection.Colors {
+		f1, f2, err := parseColor(cut.Color)
+		if err != nil {
+			continue // reported by Validate
+		}
+		for _, name := range []string{f1, f2} {
+			if _, err := fs.Parse(name); err != nil {
+				errs = append(errs, fmt.Errorf("Selection.Colors[%d]: %v", i, err))
+			}
+		}
+	}
+
+	for _, r := range cfg.RunFCCs {
+		if _, err := CamColIndex(byte(r.CamCol)); err != nil {
+			errs = append(errs, fmt.Errorf("RunFCCs[run=%d field=%d].CamCol: %v", r.Run, r.Field, err))
+		}
+	}
+
+	return errs
 }
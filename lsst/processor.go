@@ -1,9 +1,13 @@
 package lsst
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/gonuts/logger"
 )
@@ -25,16 +29,56 @@ type File struct {
 	Run    int
 }
 
+// ErrPolicy describes how a Processor reacts to a file it could not process.
+type ErrPolicy int
+
+const (
+	FailFast ErrPolicy = iota // abort the job on the first bad file
+	SkipBad                   // record the bad file and carry on
+)
+
+// ParseErrPolicy returns the error policy named s ("fail" or "skip").
+// An empty string means FailFast.
+func ParseErrPolicy(s string) (ErrPolicy, error) {
+	switch s {
+	case "", "fail":
+		return FailFast, nil
+	case "skip":
+		return SkipBad, nil
+	}
+	return FailFast, fmt.Errorf("lsst: invalid error policy %q (want fail|skip)", s)
+}
+
+// BadFile describes a file which could not be processed.
+type BadFile struct {
+	Name   string `json:"name"`
+	Run    int    `json:"run"`
+	Field  int    `json:"field"`
+	CamCol int    `json:"camcol"`
+	Filter string `json:"filter"`
+	Error  string `json:"error"`
+}
+
 // Processor is the base value holding the context to process data.
 // Processor implements the P processor interface.
 // A user-defined processor provides a .Proc function, which will be called
 // on each FITS file being processed.
+//
+// Alternatively, a user-defined processor may provide a .Map function and a
+// .Reduce function.
+// .Map is called concurrently (from NWorkers goroutines) on each FITS file
+// being processed and must not modify any state shared with other files.
+// .Reduce is then called sequentially, in the order of .Files, with the value
+// returned by .Map: this is where results are merged into the processor state.
 type Processor struct {
 	Config func(opts Options) error
 	Start  func() error
 	Proc   func(f File) error
 	Stop   func() error
 
+	Map    func(f File) (interface{}, error)
+	Reduce func(f File, v interface{}) error
+
 	name string
 	msg  *logger.Logger
 
@@ -46,10 +90,31 @@ type Processor struct {
 
 	RunFMMDb map[int]RunFieldMinMax
 
-	Files []File
+	Layout    *Layout   // layout of the input files under BaseDir
+	FilterSet FilterSet // filters of the input files
+
+	Unparsed []string // discovered files whose name could not be parsed
+
+	Files    []File
+	NWorkers int    // number of goroutines running .Map
+	Done     []File // files processed so far
+
+	// Checkpointer, if any, saves and restores the user-defined processor state.
+	Checkpointer    Checkpointer
+	CheckpointEvery int  // number of files between checkpoints (0: no checkpoint)
+	Resume          bool // whether to resume from the checkpoint in OutputDir
 
-	RaDec RaDecLim
-	Flux  [2]float64
+	OnError     ErrPolicy // what to do with files which could not be processed
+	MaxBadFiles int       // with SkipBad, abort once more than MaxBadFiles files failed (0: no limit)
+	BadFiles    []BadFile // files which could not be processed
+
+	seen        map[string]bool // files already visited
+	interrupted bool
+	aborted     bool // whether the job stopped on the last bad file
+
+	RaDec  RaDecLim
+	Region Region // selected region of the sky (default: RaDec)
+	Flux   [2]float64
 
 	Stats Stats
 }
@@ -67,10 +132,12 @@ func NewProcessor(name string) *Processor {
 		ndec   = 18
 	)
 
-	return &Processor{
+	proc := &Processor{
 		name:     name,
 		msg:      logger.New(name),
 		RunFMMDb: make(map[int]RunFieldMinMax),
+		NWorkers: 1,
+		seen:     make(map[string]bool),
 		RaDec: RaDecLim{
 			Min: RaDec{
 				Ra:  ramin,
@@ -87,6 +154,9 @@ func NewProcessor(name string) *Processor {
 		},
 		Flux: [2]float64{0, 5.0e5},
 	}
+	_ = proc.RaDec.Normalize()
+	proc.Region = &proc.RaDec
+	return proc
 }
 
 func (proc *Processor) Configure(opts Options) error {
@@ -108,11 +178,18 @@ func (proc *Processor) StartProcess() error {
 		return err
 	}
 
-	if proc.Start == nil {
-		return err
+	if proc.Start != nil {
+		err = proc.Start()
+		if err != nil {
+			return err
+		}
 	}
 
-	return proc.Start()
+	if proc.Resume {
+		err = proc.resume()
+	}
+
+	return err
 }
 
 func (proc *Processor) StopProcess() error {
@@ -134,25 +211,242 @@ func (proc *Processor) StopProcess() error {
 }
 
 func (proc *Processor) Process() error {
-	if proc.Proc == nil {
+	return proc.ProcessContext(context.Background())
+}
+
+// ProcessContext processes the input files until ctx is done.
+// Files already being processed when ctx is done are still collected.
+func (proc *Processor) ProcessContext(ctx context.Context) error {
+	if proc.Proc == nil && proc.Map == nil {
 		return fmt.Errorf("lsst: process [%s] has no Process function", proc.name)
 	}
 
-	var err error
+	files := make([]File, 0, len(proc.Files))
 	for _, f := range proc.Files {
+		if !proc.seen[f.Name] {
+			files = append(files, f)
+		}
+	}
+
+	var err error
+	if proc.Map == nil || proc.NWorkers < 2 {
+		for _, f := range files {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			err = proc.collect(proc.load(f))
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		err = proc.parallel(ctx, files)
+	}
+
+	if err == nil && proc.Stats.Files < len(proc.Files) {
+		err = ctx.Err()
+	}
+	if err != nil && ctx.Err() != nil {
+		proc.interrupted = true
+		proc.Warnf("interrupted after %d/%d files\n", proc.Stats.Files, len(proc.Files))
+	}
+	return err
+}
+
+// result is the outcome of the map stage for a given file.
+type result struct {
+	idx     int
+	key     string // name of the file, as configured
+	file    File   // file, with the name of its (possibly compressed) variant on disk
+	size    int64
+	missing bool
+	v       interface{}
+	err     error
+}
+
+// load checks the file (or one of its compressed variants) exists and
+// runs the map stage on it.
+func (proc *Processor) load(f File) result {
+	res := result{key: f.Name, file: f}
+	name, fi, err := ResolvePath(f.Name)
+	if err != nil {
+		res.missing = true
+		return res
+	}
+	f.Name = name
+	res.file = f
+	res.size = fi.Size()
+
+	if proc.Map != nil {
+		res.v, res.err = proc.mapFile(f)
+	}
+	return res
+}
+
+// mapFile runs the map stage on f.
+// A panic while reading a corrupt file is turned into an error, so the file
+// is handled as any other bad file.
+func (proc *Processor) mapFile(f File) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("lsst: panic reading [%s]: %v", f.Name, r)
+		}
+	}()
+	return proc.Map(f)
+}
+
+// collect updates the statistics and runs the reduce stage on a map result.
+func (proc *Processor) collect(res result) (err error) {
+	defer func() {
+		if err != nil || proc.CheckpointEvery <= 0 || proc.Stats.Files%proc.CheckpointEvery != 0 {
+			return
+		}
+		if e := proc.writeCheckpoint(); e != nil {
+			proc.Warnf("could not write checkpoint: %v\n", e)
+		}
+	}()
+
+	if res.missing {
 		proc.Stats.Files += 1
-		if fi, estat := os.Stat(f.Name); estat != nil {
-			proc.Stats.MissingFiles += 1
-			continue
-		} else {
-			proc.Stats.FilesSize += fi.Size()
+		proc.Stats.MissingFiles += 1
+		proc.seen[res.key] = true
+		return nil
+	}
+
+	err = res.err
+	if err == nil {
+		switch {
+		case proc.Map == nil:
+			err = proc.Proc(res.file)
+		case proc.Reduce != nil:
+			err = proc.Reduce(res.file, res.v)
 		}
-		err = proc.Proc(f)
+	}
+
+	if err != nil {
+		err = proc.bad(res.file, err)
 		if err != nil {
-			proc.Stats.BadFiles += 1
+			// the file is not marked as visited, so a resumed job
+			// processes it again.
+			proc.aborted = true
 			return err
 		}
+	} else {
+		proc.Done = append(proc.Done, res.file)
+	}
+
+	proc.Stats.Files += 1
+	proc.Stats.FilesSize += res.size
+	proc.seen[res.key] = true
+	return err
+}
+
+// bad records a file which could not be processed and applies the error policy.
+func (proc *Processor) bad(f File, err error) error {
+	proc.Stats.BadFiles += 1
+	proc.BadFiles = append(proc.BadFiles, BadFile{
+		Name:   f.Name,
+		Run:    f.Run,
+		Field:  f.Field,
+		CamCol: int(f.CamCol),
+		Filter: string(f.Filter),
+		Error:  err.Error(),
+	})
+
+	switch proc.OnError {
+	case SkipBad:
+		if proc.MaxBadFiles > 0 && proc.Stats.BadFiles > proc.MaxBadFiles {
+			return fmt.Errorf("lsst: too many bad files (%d > %d). last error: %v",
+				proc.Stats.BadFiles, proc.MaxBadFiles, err,
+			)
+		}
+		proc.Warnf("skipping bad file [%s]: %v\n", f.Name, err)
+		return nil
 	}
+
+	return err
+}
+
+// parallel runs the map stage on NWorkers goroutines and the reduce stage
+// sequentially, in the order of files.
+// No new file is dispatched once ctx is done.
+func (proc *Processor) parallel(ctx context.Context, files []File) error {
+	var (
+		wg      sync.WaitGroup
+		jobs    = make(chan int)
+		results = make(chan result, proc.NWorkers)
+		quit    = make(chan struct{})
+
+		// slots bounds the number of map results waiting to be reduced
+		slots = make(chan struct{}, 2*proc.NWorkers)
+	)
+
+	wg.Add(proc.NWorkers)
+	for i := 0; i < proc.NWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				res := proc.load(files[idx])
+				res.idx = idx
+				select {
+				case results <- res:
+				case <-quit:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for idx := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-quit:
+				return
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- idx:
+			case <-quit:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var err error
+	next := 0
+	pending := make(map[int]result, cap(slots))
+	for res := range results {
+		pending[res.idx] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-slots
+
+			err = proc.collect(res)
+			if err != nil {
+				close(quit)
+				for range results {
+					// wait for in-flight workers
+				}
+				return err
+			}
+		}
+	}
+
 	return err
 }
 
@@ -180,6 +474,54 @@ func (proc *Processor) configure(opts Options) error {
 
 	proc.BaseDir = cfg.BaseDir
 	proc.OutputDir = cfg.OutDir
+	if cfg.NWorkers > 0 {
+		proc.NWorkers = cfg.NWorkers
+	}
+	proc.CheckpointEvery = cfg.Checkpoint
+	proc.Resume = cfg.Resume
+
+	proc.OnError, err = ParseErrPolicy(cfg.OnError)
+	if err != nil {
+		return err
+	}
+	proc.MaxBadFiles = cfg.MaxBadFiles
+
+	proc.Layout, err = NewLayout(cfg.BaseDir, cfg.PathTemplate)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.RaDec.isZero() {
+		radec := cfg.RaDec
+		err = radec.Normalize()
+		if err != nil {
+			return err
+		}
+		proc.RaDec = radec
+	}
+
+	if cfg.Flux != [2]float64{} {
+		proc.Flux = cfg.Flux
+	}
+
+	if len(cfg.Regions) > 0 {
+		proc.Region, err = NewRegion(cfg.Regions)
+		if err != nil {
+			return err
+		}
+	}
+
+	proc.FilterSet, err = LookupFilterSet(cfg.FilterSet)
+	if err != nil {
+		return err
+	}
+
+	if errs := cfg.checkFilters(proc.FilterSet); len(errs) > 0 {
+		for _, err := range errs {
+			proc.Errorf("%v\n", err)
+		}
+		return fmt.Errorf("invalid configuration")
+	}
 
 	switch {
 	case cfg.RunFMMs != nil:
@@ -188,28 +530,33 @@ func (proc *Processor) configure(opts Options) error {
 		for _, r := range cfg.RunFMMs {
 			//proc.Infof("==> %#v\n", r)
 
-			camcol := byte(1)
-			filter := byte('i')
+			camcols := r.CamCols
+			if len(camcols) == 0 {
+				camcols = CamCols
+			}
 
-			ccfd := fmt.Sprintf("%d/%s", camcol, string(filter))
-			ccfn := fmt.Sprintf("%s%d", string(filter), camcol)
+			filters := r.Filters
+			if len(filters) == 0 {
+				filters = cfg.Filters
+			}
+			if len(filters) == 0 {
+				proc.Errorf("no filter for run %d (one needs either RunFMMs.Filters or Filters)\n", r.Run)
+				return fmt.Errorf("invalid configuration")
+			}
 
+			// files are ordered by run and field
 			for field := r.FieldMin; field <= r.FieldMax; field++ {
-				fname := fmt.Sprintf(
-					"forcedsources-%06d-%s-%04d.fits",
-					r.Run,
-					ccfn,
-					field,
-				)
-				proc.Files = append(proc.Files,
-					File{
-						Name:   filepath.Join(cfg.BaseDir, fmt.Sprintf("%d", r.Run), ccfd, fname),
-						Filter: filter,
-						CamCol: camcol,
-						Field:  field,
-						Run:    r.Run,
-					},
-				)
+				for _, cc := range camcols {
+					camcol := byte(cc)
+					for _, sfilter := range filters {
+						filter, _ := proc.FilterSet.Parse(sfilter)
+						f, err := proc.Layout.File(r.Run, field, camcol, filter)
+						if err != nil {
+							return err
+						}
+						proc.Files = append(proc.Files, f)
+					}
+				}
 			}
 		}
 
@@ -218,31 +565,51 @@ func (proc *Processor) configure(opts Options) error {
 		for _, r := range cfg.RunFCCs {
 			camcol := byte(r.CamCol)
 			for _, sfilter := range cfg.Filters {
-				filter := byte(sfilter[0])
-				ccfd := fmt.Sprintf("%d/%s", camcol, sfilter)
-				ccfn := fmt.Sprintf("%s%d", sfilter, camcol)
-
-				fname := fmt.Sprintf(
-					"forcedsources-%06d-%s-%04d.fits",
-					r.Run,
-					ccfn,
-					r.Field,
-				)
-				proc.Files = append(proc.Files,
-					File{
-						Name:   filepath.Join(cfg.BaseDir, fmt.Sprintf("%d", r.Run), ccfd, fname),
-						Filter: filter,
-						CamCol: camcol,
-						Field:  r.Field,
-						Run:    r.Run,
-					},
-				)
-
+				filter, _ := proc.FilterSet.Parse(sfilter)
+				f, err := proc.Layout.File(r.Run, r.Field, camcol, filter)
+				if err != nil {
+					return err
+				}
+				proc.Files = append(proc.Files, f)
 			}
 		}
 
+	case cfg.FileList != "":
+		parser, err := NewNameParser(cfg.BaseDir, cfg.NamePattern)
+		if err != nil {
+			return err
+		}
+
+		files, unparsed, err := readFileList(cfg.FileList, proc.Layout, proc.FilterSet, parser)
+		if err != nil {
+			return err
+		}
+		for _, name := range unparsed {
+			proc.Warnf("unparsable file name [%s]\n", name)
+		}
+		proc.Infof(">>> file list [%s]: %d files (unparsable: %d)\n", cfg.FileList, len(files), len(unparsed))
+		proc.Files = append(proc.Files, files...)
+		proc.Unparsed = append(proc.Unparsed, unparsed...)
+
+	case len(cfg.Globs) > 0 || cfg.Walk:
+		parser, err := NewNameParser(cfg.BaseDir, cfg.NamePattern)
+		if err != nil {
+			return err
+		}
+
+		files, unparsed, err := discover(parser, cfg.Globs)
+		if err != nil {
+			return err
+		}
+		for _, name := range unparsed {
+			proc.Warnf("unparsable file name [%s]\n", name)
+		}
+		proc.Infof(">>> discovered files: %d (unparsable: %d)\n", len(files), len(unparsed))
+		proc.Files = append(proc.Files, files...)
+		proc.Unparsed = append(proc.Unparsed, unparsed...)
+
 	default:
-		proc.Errorf("one needs either a RunFMM or RunFCC list\n")
+		proc.Errorf("one needs either a RunFMM or RunFCC list, a FileList, Globs or Walk\n")
 		return fmt.Errorf("invalid configuration")
 	}
 
@@ -262,15 +629,123 @@ func (proc *Processor) start() error {
 	return err
 }
 
+// resume restores the processor state from the last checkpoint, if any.
+func (proc *Processor) resume() error {
+	err := proc.readCheckpoint()
+	switch {
+	case os.IsNotExist(err):
+		proc.Warnf("no checkpoint in [%s]. starting from scratch\n", proc.OutputDir)
+		return nil
+	case err != nil:
+		return err
+	}
+	proc.Infof("resuming from checkpoint: %d/%d files already processed\n",
+		len(proc.seen), len(proc.Files),
+	)
+	return err
+}
+
+// Complete returns whether all the input files have been processed.
+func (proc *Processor) Complete() bool {
+	return proc.Stats.Files >= len(proc.Files)
+}
+
 func (proc *Processor) stop() error {
 	var err error
+
+	switch {
+	case !proc.Complete():
+		if proc.CheckpointEvery > 0 {
+			err = proc.writeCheckpoint()
+			if err != nil {
+				return err
+			}
+			proc.Infof("checkpoint saved to [%s]\n", proc.checkpointName())
+		}
+	default:
+		// the job is complete: a later -resume must not skip anything.
+		_ = os.Remove(proc.checkpointName())
+	}
+
 	proc.Infof("----- stats -----\n")
 	proc.Infof(" #files:     %d\n", proc.Stats.Files)
 	proc.Infof(" #missing:   %d\n", proc.Stats.MissingFiles)
 	proc.Infof(" #bad:       %d\n", proc.Stats.BadFiles)
+	if len(proc.Unparsed) > 0 {
+		proc.Infof(" #unparsed:  %d\n", len(proc.Unparsed))
+	}
 	proc.Infof(" total size: %d kb\n", proc.Stats.FilesSize/1024)
+	if proc.interrupted {
+		proc.Infof(" interrupted: %d/%d files\n", proc.Stats.Files, len(proc.Files))
+	}
 	proc.Infof("-----------------\n")
+
+	err = proc.writeDone()
+	if err != nil {
+		return err
+	}
+
+	err = proc.writeBadFiles()
+	if err != nil {
+		return err
+	}
+
 	return err
 }
 
+// writeDone writes the list of processed files to the output directory.
+func (proc *Processor) writeDone() error {
+	fname := filepath.Join(proc.OutputDir, "processed.txt")
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "## files processed: %d/%d", len(proc.Done), len(proc.Files))
+	if proc.interrupted {
+		fmt.Fprintf(w, " (interrupted)")
+	}
+	fmt.Fprintf(w, "\n")
+	for _, file := range proc.Done {
+		fmt.Fprintf(w, "%s\n", file.Name)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// writeBadFiles writes the report of files which could not be processed
+// to the output directory.
+func (proc *Processor) writeBadFiles() error {
+	fname := filepath.Join(proc.OutputDir, "bad_files.json")
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bad := proc.BadFiles
+	if bad == nil {
+		bad = []BadFile{}
+	}
+
+	buf, err := json.MarshalIndent(bad, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(buf, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
 // EOF
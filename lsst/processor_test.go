@@ -0,0 +1,229 @@
+package lsst
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestProcessor creates a processor over n files in dir, missing the
+// files for which missing returns true.
+// The map stage returns the field of each file, after a delay scrambling
+// the order in which the workers complete.
+func newTestProcessor(t *testing.T, dir string, n int, missing func(i int) bool) *Processor {
+	proc := NewProcessor("test")
+	proc.OutputDir = dir
+	for i := 0; i < n; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file-%03d.fits", i))
+		if missing == nil || !missing(i) {
+			err := os.WriteFile(name, []byte("data"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		proc.Files = append(proc.Files, File{Name: name, Run: 1752, Field: i})
+	}
+	proc.Map = func(f File) (interface{}, error) {
+		time.Sleep(time.Duration((f.Field*7919)%13) * 10 * time.Microsecond)
+		return f.Field, nil
+	}
+	return proc
+}
+
+func TestProcessorOrderedReduce(t *testing.T) {
+	for _, nworkers := range []int{1, 2, 8} {
+		t.Run(fmt.Sprintf("nworkers=%d", nworkers), func(t *testing.T) {
+			missing := func(i int) bool { return i%7 == 3 }
+			proc := newTestProcessor(t, t.TempDir(), 100, missing)
+			proc.NWorkers = nworkers
+
+			var got []int
+			proc.Reduce = func(f File, v interface{}) error {
+				if v.(int) != f.Field {
+					return fmt.Errorf("reduce of field %d got the map result of field %d", f.Field, v)
+				}
+				got = append(got, v.(int))
+				return nil
+			}
+
+			err := proc.Process()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []int
+			for i := 0; i < 100; i++ {
+				if !missing(i) {
+					want = append(want, i)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("reduced fields:\ngot= %v\nwant=%v", got, want)
+			}
+			if proc.Stats.Files != 100 || proc.Stats.MissingFiles != 14 || len(proc.Done) != 86 {
+				t.Fatalf("got stats %+v, %d files done (want=100 files, 14 missing, 86 done)",
+					proc.Stats, len(proc.Done),
+				)
+			}
+		})
+	}
+}
+
+func TestProcessorOnError(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		policy  ErrPolicy
+		maxBad  int
+		panics  bool // whether the map stage panics on bad files
+		err     bool // whether the job fails
+		files   int  // number of files processed
+		badFile int  // number of bad files recorded
+	}{
+		{name: "fail-fast", policy: FailFast, err: true, files: 10, badFile: 1},
+		{name: "fail-fast-panic", policy: FailFast, panics: true, err: true, files: 10, badFile: 1},
+		{name: "skip-bad", policy: SkipBad, files: 50, badFile: 5},
+		{name: "skip-bad-panic", policy: SkipBad, panics: true, files: 50, badFile: 5},
+		{name: "skip-bad-max", policy: SkipBad, maxBad: 5, files: 50, badFile: 5},
+		{name: "skip-bad-too-many", policy: SkipBad, maxBad: 2, err: true, files: 30, badFile: 3},
+	} {
+		for _, nworkers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/nworkers=%d", tc.name, nworkers), func(t *testing.T) {
+				proc := newTestProcessor(t, t.TempDir(), 50, nil)
+				proc.NWorkers = nworkers
+				proc.OnError = tc.policy
+				proc.MaxBadFiles = tc.maxBad
+
+				// every 10th file is bad.
+				mapf := proc.Map
+				proc.Map = func(f File) (interface{}, error) {
+					if f.Field%10 == 9 {
+						if tc.panics {
+							panic("truncated file")
+						}
+						return nil, fmt.Errorf("truncated file")
+					}
+					return mapf(f)
+				}
+				proc.Reduce = func(f File, v interface{}) error { return nil }
+
+				err := proc.Process()
+				if got := err != nil; got != tc.err {
+					t.Fatalf("got error %v (want error: %v)", err, tc.err)
+				}
+				if proc.Stats.BadFiles != tc.badFile || len(proc.BadFiles) != tc.badFile {
+					t.Fatalf("got %d bad files, %d recorded (want=%d)",
+						proc.Stats.BadFiles, len(proc.BadFiles), tc.badFile,
+					)
+				}
+				if want := tc.files; tc.err {
+					// the file stopping the job is not counted as processed.
+					if proc.Stats.Files != want-1 {
+						t.Fatalf("got %d files (want=%d)", proc.Stats.Files, want-1)
+					}
+				} else if proc.Stats.Files != want {
+					t.Fatalf("got %d files (want=%d)", proc.Stats.Files, want)
+				}
+				for _, bf := range proc.BadFiles {
+					if bf.Field%10 != 9 || bf.Run != 1752 || bf.Error == "" {
+						t.Fatalf("invalid bad file record %+v", bf)
+					}
+				}
+			})
+		}
+	}
+}
+
+// sumCheckpointer saves the sum of the fields of the reduced files.
+type sumCheckpointer struct{ sum *int }
+
+func (c sumCheckpointer) Checkpoint(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%d", *c.sum)
+	return err
+}
+
+func (c sumCheckpointer) Restore(r io.Reader) error {
+	_, err := fmt.Fscanf(r, "%d", c.sum)
+	return err
+}
+
+func TestProcessorResume(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		stop func(cancel func()) error // stops the first job, at field 42
+	}{
+		{
+			name: "interrupted",
+			stop: func(cancel func()) error { cancel(); return nil },
+		},
+		{
+			name: "fail-fast",
+			stop: func(cancel func()) error { return fmt.Errorf("bad file") },
+		},
+	} {
+		for _, nworkers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/nworkers=%d", tc.name, nworkers), func(t *testing.T) {
+				dir := t.TempDir()
+				newProc := func(stop func() error) (*Processor, *int) {
+					proc := newTestProcessor(t, dir, 100, nil)
+					proc.NWorkers = nworkers
+					proc.CheckpointEvery = 10
+					sum := new(int)
+					proc.Checkpointer = sumCheckpointer{sum}
+					proc.Reduce = func(f File, v interface{}) error {
+						if f.Field == 42 && stop != nil {
+							if err := stop(); err != nil {
+								return err
+							}
+						}
+						*sum += v.(int)
+						return nil
+					}
+					return proc, sum
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				proc, _ := newProc(func() error { return tc.stop(cancel) })
+				err := proc.ProcessContext(ctx)
+				if err == nil {
+					t.Fatalf("first job: expected an error")
+				}
+				if proc.Complete() {
+					t.Fatalf("first job: complete after an error")
+				}
+				err = proc.stop()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				proc, sum := newProc(nil)
+				proc.Resume = true
+				err = proc.resume()
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = proc.Process()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *sum != 99*100/2 || proc.Stats.Files != 100 || proc.Stats.BadFiles != 0 {
+					t.Fatalf("resumed job: sum=%d stats=%+v (want sum=4950, 100 files, no bad files)",
+						*sum, proc.Stats,
+					)
+				}
+
+				err = proc.stop()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Stat(proc.checkpointName()); !os.IsNotExist(err) {
+					t.Fatalf("checkpoint of a complete job not removed: %v", err)
+				}
+			})
+		}
+	}
+}
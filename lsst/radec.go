@@ -0,0 +1,245 @@
+package lsst
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	deg2rad = math.Pi / 180.0
+	rad2deg = 180.0 / math.Pi
+)
+
+// normAxis derives the missing one of the range [min,max], count n and
+// width w of a binned axis.
+// The range is not given when min and max are both zero: a given empty
+// range is rejected, but for a full turn of a periodic axis (period > 0.)
+func normAxis(name string, min float64, max *float64, n *int, w *float64, period float64) error {
+	const eps = 1e-6
+	var (
+		hasRange = min != 0 || *max != 0
+		hasN     = *n > 0
+		hasW     = *w > 0
+	)
+
+	if hasRange && *max == min {
+		turn := period > 0 && hasN && hasW &&
+			math.Abs(float64(*n)**w-period) <= eps*period
+		if !turn {
+			return fmt.Errorf("lsst: empty %s range [%v, %v]", name, min, *max)
+		}
+		*max = min + period
+	}
+
+	switch {
+	case hasRange && *max < min:
+		return fmt.Errorf("lsst: empty %s range [%v, %v]", name, min, *max)
+
+	case hasRange && hasN && hasW:
+		span := *max - min
+		if math.Abs(float64(*n)**w-span) > eps*span {
+			return fmt.Errorf("lsst: inconsistent %s binning: %d cells of width %v do not span [%v, %v]",
+				name, *n, *w, min, *max,
+			)
+		}
+
+	case hasRange && hasN:
+		*w = (*max - min) / float64(*n)
+
+	case hasRange && hasW:
+		span := *max - min
+		nn := math.Floor(span / *w + 0.5)
+		if nn < 1 || math.Abs(nn**w-span) > eps*span {
+			return fmt.Errorf("lsst: %s range [%v, %v] is not a multiple of the cell width %v",
+				name, min, *max, *w,
+			)
+		}
+		*n = int(nn)
+		*w = span / nn
+
+	case hasN && hasW:
+		*max = min + float64(*n)**w
+
+	default:
+		return fmt.Errorf("lsst: %s binning needs two of (range, count, width)", name)
+	}
+	return nil
+}
+
+// RaWrap returns the ra angle (in degrees) wrapped into [0, 360).
+func RaWrap(ra float64) float64 {
+	ra = math.Mod(ra, 360)
+	if ra < 0 {
+		ra += 360
+	}
+	return ra
+}
+
+// RaDiff returns the signed difference a-b of two ra angles (in degrees),
+// in [-180, 180).
+func RaDiff(a, b float64) float64 {
+	return RaWrap(a-b+180) - 180
+}
+
+// RaRange returns the smallest ra interval [min, max] holding all the
+// ra angles (in degrees.)
+// The interval is computed on the circle: min > max means the interval
+// crosses ra=0 (e.g. [350, 10]).
+func RaRange(ras []float64) (min, max float64) {
+	if len(ras) == 0 {
+		return 0, 0
+	}
+
+	sorted := make([]float64, len(ras))
+	for i, ra := range ras {
+		sorted[i] = RaWrap(ra)
+	}
+	sort.Float64s(sorted)
+
+	// the interval is the complement of the largest gap between
+	// consecutive angles, starting with the gap across ra=0.
+	n := len(sorted)
+	min, max = sorted[0], sorted[n-1]
+	gap := sorted[0] + 360 - sorted[n-1]
+	for i := 1; i < n; i++ {
+		if d := sorted[i] - sorted[i-1]; d > gap {
+			gap = d
+			min, max = sorted[i], sorted[i-1]
+		}
+	}
+	return min, max
+}
+
+// Normalize derives the missing binning parameters of the region and
+// checks their consistency.
+// A region with Min.Ra > Max.Ra crosses ra=0 (e.g. from 300 to 60 degrees.)
+// Normalize needs to be called before Index, NbCells or Center.
+func (lim *RaDecLim) Normalize() error {
+	// unwrap the ra range for the binning.
+	if lim.Max.Ra < lim.Min.Ra {
+		lim.Max.Ra += 360
+	}
+	err := normAxis("ra", lim.Min.Ra, &lim.Max.Ra, &lim.NbRa, &lim.DeltaRa, 360)
+	if err == nil {
+		const eps = 1e-6
+		switch span := lim.Max.Ra - lim.Min.Ra; {
+		case math.Abs(span-360) < eps*360:
+			lim.Max.Ra = lim.Min.Ra + 360
+		case span > 360:
+			err = fmt.Errorf("lsst: ra range [%v, %v] spans more than 360 degrees",
+				lim.Min.Ra, lim.Max.Ra,
+			)
+		}
+	}
+	if lim.Max.Ra > 360 {
+		lim.Max.Ra -= 360
+	}
+	if err != nil {
+		return err
+	}
+
+	err = normAxis("dec", lim.Min.Dec, &lim.Max.Dec, &lim.NbDec, &lim.DeltaDec, 0)
+	if err != nil {
+		return err
+	}
+
+	lim.bands = nil
+	if !lim.EqualArea {
+		return err
+	}
+
+	lim.bands = make([]int, lim.NbDec+1)
+	for i := 0; i < lim.NbDec; i++ {
+		lim.bands[i+1] = lim.bands[i] + lim.nbRa(i)
+	}
+
+	return err
+}
+
+// nbRa returns the number of ra cells of the i-th dec band.
+func (lim *RaDecLim) nbRa(i int) int {
+	if !lim.EqualArea {
+		return lim.NbRa
+	}
+
+	// mean of cos(dec) over the band
+	dec1 := (lim.Min.Dec + float64(i)*lim.DeltaDec) * deg2rad
+	dec2 := dec1 + lim.DeltaDec*deg2rad
+	cos := (math.Sin(dec2) - math.Sin(dec1)) / (dec2 - dec1)
+
+	n := int(math.Floor(float64(lim.NbRa)*cos + 0.5))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// NbCells returns the number of cells of the region.
+func (lim *RaDecLim) NbCells() int {
+	if lim.EqualArea {
+		return lim.bands[lim.NbDec]
+	}
+	return lim.NbRa * lim.NbDec
+}
+
+// Index returns the index of the cell holding (ra,dec) and whether
+// (ra,dec) is inside the region.
+func (lim *RaDecLim) Index(ra, dec float64) (int, bool) {
+	kdec := int(math.Floor((dec - lim.Min.Dec) / lim.DeltaDec))
+	if kdec < 0 || kdec >= lim.NbDec {
+		return -1, false
+	}
+
+	nra := lim.nbRa(kdec)
+	dra := lim.raSpan() / float64(nra)
+	kra := int(math.Floor(lim.raOffset(ra) / dra))
+	if kra < 0 || kra >= nra {
+		return -1, false
+	}
+
+	if lim.EqualArea {
+		return lim.bands[kdec] + kra, true
+	}
+	return kdec*lim.NbRa + kra, true
+}
+
+// Center returns the center of the cell with index idx.
+func (lim *RaDecLim) Center(idx int) RaDec {
+	var kdec, kra int
+	switch {
+	case lim.EqualArea:
+		kdec = sort.SearchInts(lim.bands, idx+1) - 1
+		kra = idx - lim.bands[kdec]
+	default:
+		kdec = idx / lim.NbRa
+		kra = idx % lim.NbRa
+	}
+
+	dra := lim.raSpan() / float64(lim.nbRa(kdec))
+	return RaDec{
+		Ra:  RaWrap(lim.Min.Ra + dra*(float64(kra)+0.5)),
+		Dec: lim.Min.Dec + lim.DeltaDec*(float64(kdec)+0.5),
+	}
+}
+
+// raSpan returns the width of the ra range of the region.
+func (lim *RaDecLim) raSpan() float64 {
+	span := lim.Max.Ra - lim.Min.Ra
+	if span <= 0 {
+		span += 360
+	}
+	return span
+}
+
+// raOffset returns the angle from Min.Ra to ra, going eastward, in [0, 360).
+func (lim *RaDecLim) raOffset(ra float64) float64 {
+	return RaWrap(ra - lim.Min.Ra)
+}
+
+// isZero returns whether the region has not been configured at all.
+func (lim *RaDecLim) isZero() bool {
+	return lim.Min == (RaDec{}) && lim.Max == (RaDec{}) &&
+		lim.NbRa == 0 && lim.NbDec == 0 &&
+		lim.DeltaRa == 0 && lim.DeltaDec == 0
+}
@@ -0,0 +1,166 @@
+package lsst
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRaDecLimIndexWrap(t *testing.T) {
+	// 12 cells of 10 degrees in ra, from 300 to 60 through ra=0.
+	lim := RaDecLim{
+		Min:  RaDec{Ra: 300, Dec: -10},
+		Max:  RaDec{Ra: 60, Dec: 10},
+		NbRa: 12, NbDec: 2,
+	}
+	err := lim.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lim.DeltaRa != 10 || lim.DeltaDec != 10 {
+		t.Fatalf("got DeltaRa=%v DeltaDec=%v (want=10, 10)", lim.DeltaRa, lim.DeltaDec)
+	}
+
+	for _, tc := range []struct {
+		ra, dec float64
+		idx     int
+		ok      bool
+	}{
+		{ra: 300, dec: -10, idx: 0, ok: true},
+		{ra: 305, dec: -5, idx: 0, ok: true},
+		{ra: 359.9, dec: -5, idx: 5, ok: true},
+		{ra: 0, dec: -5, idx: 6, ok: true},
+		{ra: 360, dec: -5, idx: 6, ok: true},
+		{ra: -5, dec: -5, idx: 5, ok: true},
+		{ra: 59, dec: -5, idx: 11, ok: true},
+		{ra: 59, dec: 5, idx: 23, ok: true},
+		{ra: 61, dec: 5, ok: false},
+		{ra: 180, dec: 5, ok: false},
+		{ra: 299, dec: 5, ok: false},
+		{ra: 0, dec: 11, ok: false},
+		{ra: 0, dec: -11, ok: false},
+	} {
+		idx, ok := lim.Index(tc.ra, tc.dec)
+		if ok != tc.ok || (ok && idx != tc.idx) {
+			t.Errorf("Index(%v, %v) = (%d, %v) (want=(%d, %v))",
+				tc.ra, tc.dec, idx, ok, tc.idx, tc.ok,
+			)
+		}
+	}
+}
+
+func TestRaDecLimCenter(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		lim  RaDecLim
+	}{
+		{
+			name: "full-sky",
+			lim: RaDecLim{
+				Min: RaDec{Ra: 0, Dec: -90}, Max: RaDec{Ra: 360, Dec: 90},
+				NbRa: 36, NbDec: 18,
+			},
+		},
+		{
+			name: "ra-wrap",
+			lim: RaDecLim{
+				Min: RaDec{Ra: 300, Dec: -10}, Max: RaDec{Ra: 60, Dec: 10},
+				NbRa: 12, NbDec: 2,
+			},
+		},
+		{
+			name: "equal-area",
+			lim: RaDecLim{
+				Min: RaDec{Ra: 0, Dec: -90}, Max: RaDec{Ra: 360, Dec: 90},
+				NbRa: 36, DeltaDec: 10, EqualArea: true,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lim := tc.lim
+			err := lim.Normalize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < lim.NbCells(); i++ {
+				c := lim.Center(i)
+				if c.Ra < 0 || c.Ra >= 360 || math.Abs(c.Dec) > 90 {
+					t.Fatalf("cell %d: invalid center %v", i, c)
+				}
+				j, ok := lim.Index(c.Ra, c.Dec)
+				if !ok || j != i {
+					t.Fatalf("cell %d: center %v has index (%d, %v)", i, c, j, ok)
+				}
+			}
+		})
+	}
+
+	lim := RaDecLim{
+		Min: RaDec{Ra: 300, Dec: -10}, Max: RaDec{Ra: 60, Dec: 10},
+		NbRa: 12, NbDec: 2,
+	}
+	err := lim.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := lim.Center(6); c.Ra != 5 || c.Dec != -5 {
+		t.Errorf("Center(6) = %v (want={5, -5})", c)
+	}
+	if c := lim.Center(5); c.Ra != 355 || c.Dec != -5 {
+		t.Errorf("Center(5) = %v (want={355, -5})", c)
+	}
+}
+
+func TestRaDecLimNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		lim  RaDecLim
+		max  RaDec // normalized Max
+		ok   bool
+	}{
+		{
+			name: "derived-delta",
+			lim:  RaDecLim{Min: RaDec{Ra: 0, Dec: -90}, Max: RaDec{Ra: 360, Dec: 90}, NbRa: 36, NbDec: 18},
+			max:  RaDec{Ra: 360, Dec: 90},
+			ok:   true,
+		},
+		{
+			name: "derived-range",
+			lim:  RaDecLim{NbRa: 12, DeltaRa: 10, NbDec: 2, DeltaDec: 10},
+			max:  RaDec{Ra: 120, Dec: 20},
+			ok:   true,
+		},
+		{
+			name: "full-turn",
+			lim:  RaDecLim{Min: RaDec{Ra: 300, Dec: -10}, Max: RaDec{Ra: 300, Dec: 10}, NbRa: 36, DeltaRa: 10, NbDec: 2},
+			max:  RaDec{Ra: 300, Dec: 10},
+			ok:   true,
+		},
+		{
+			name: "empty-ra-range",
+			lim:  RaDecLim{Min: RaDec{Ra: 300, Dec: -10}, Max: RaDec{Ra: 300, Dec: 10}, NbRa: 12, DeltaRa: 10, NbDec: 2},
+		},
+		{
+			name: "empty-dec-range",
+			lim:  RaDecLim{Min: RaDec{Ra: 0, Dec: -90}, Max: RaDec{Ra: 360, Dec: -90}, NbRa: 36, NbDec: 18, DeltaRa: 10, DeltaDec: 10},
+		},
+		{
+			name: "inconsistent-delta",
+			lim:  RaDecLim{Min: RaDec{Ra: 0, Dec: -90}, Max: RaDec{Ra: 360, Dec: 90}, NbRa: 36, NbDec: 18, DeltaRa: 11, DeltaDec: 10},
+		},
+		{
+			name: "more-than-360",
+			lim:  RaDecLim{Min: RaDec{Ra: 0, Dec: -10}, NbRa: 37, DeltaRa: 10, NbDec: 2, DeltaDec: 10},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lim := tc.lim
+			err := lim.Normalize()
+			if ok := err == nil; ok != tc.ok {
+				t.Fatalf("Normalize: err=%v (want ok=%v)", err, tc.ok)
+			}
+			if tc.ok && lim.Max != tc.max {
+				t.Fatalf("Normalize: Max=%v (want=%v)", lim.Max, tc.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package lsst
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Region is a portion of the sky.
+type Region interface {
+	// Contains returns whether the direction p is inside the region.
+	Contains(p RaDec) bool
+}
+
+// Cone is the region within Radius (in degrees) of Center.
+type Cone struct {
+	Center RaDec
+	Radius float64
+}
+
+// Contains implements Region
+func (c Cone) Contains(p RaDec) bool {
+	return AngDist(c.Center, p) <= c.Radius
+}
+
+// Box is the region bounded by two meridians and two parallels.
+// A box with Min.Ra > Max.Ra crosses ra=0.
+type Box struct {
+	Min RaDec
+	Max RaDec
+}
+
+// Contains implements Region
+func (b Box) Contains(p RaDec) bool {
+	if p.Dec < b.Min.Dec || p.Dec > b.Max.Dec {
+		return false
+	}
+	span := b.Max.Ra - b.Min.Ra
+	if span < 0 {
+		span += 360
+	}
+	return RaWrap(p.Ra-b.Min.Ra) <= span
+}
+
+// Polygon is a convex spherical polygon, bounded by the great circles
+// through consecutive vertices.
+// Polygons need to be created with NewPolygon.
+type Polygon struct {
+	Vertices []RaDec
+	edges    []vec3 // inward normals of the edges
+}
+
+// NewPolygon creates a convex spherical polygon from its vertices,
+// given in either direction.
+func NewPolygon(vertices []RaDec) (*Polygon, error) {
+	const eps = 1e-12
+
+	n := len(vertices)
+	if n < 3 {
+		return nil, fmt.Errorf("lsst: polygon needs at least 3 vertices (got %d)", n)
+	}
+
+	vs := make([]vec3, n)
+	var center vec3
+	for i, v := range vertices {
+		vs[i] = unitVec(v)
+		center = center.add(vs[i])
+	}
+
+	poly := &Polygon{
+		Vertices: vertices,
+		edges:    make([]vec3, n),
+	}
+	for i := range vs {
+		e := vs[i].cross(vs[(i+1)%n])
+		norm := e.norm()
+		if norm < eps {
+			return nil, fmt.Errorf("lsst: polygon has a degenerate edge %v-%v",
+				vertices[i], vertices[(i+1)%n],
+			)
+		}
+		poly.edges[i] = e.scale(1 / norm)
+	}
+
+	// orient the edges toward the inside of the polygon.
+	if center.dot(poly.edges[0]) < 0 {
+		for i, e := range poly.edges {
+			poly.edges[i] = e.scale(-1)
+		}
+	}
+
+	for i, e := range poly.edges {
+		for j, v := range vs {
+			if e.dot(v) < -1e-9 {
+				return nil, fmt.Errorf("lsst: polygon is not convex (vertex %v outside of edge %d)",
+					vertices[j], i,
+				)
+			}
+		}
+	}
+
+	return poly, nil
+}
+
+// Contains implements Region
+func (poly *Polygon) Contains(p RaDec) bool {
+	v := unitVec(p)
+	for _, e := range poly.edges {
+		if e.dot(v) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Union is the union of regions.
+type Union []Region
+
+// Contains implements Region
+func (u Union) Contains(p RaDec) bool {
+	for _, r := range u {
+		if r.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains implements Region
+func (lim *RaDecLim) Contains(p RaDec) bool {
+	_, ok := lim.Index(p.Ra, p.Dec)
+	return ok
+}
+
+// RegionOptions describes a region of the sky in the jobo.
+//
+// Type selects the kind of region and the fields used to describe it:
+//   - "cone":    Center and Radius (in degrees)
+//   - "box":     Min and Max
+//   - "polygon": Vertices, as [ra, dec] pairs of a convex polygon
+type RegionOptions struct {
+	Type     string
+	Center   RaDec
+	Radius   float64
+	Min      RaDec
+	Max      RaDec
+	Vertices [][2]float64
+}
+
+// New creates the region described by the options.
+func (o RegionOptions) New() (Region, error) {
+	switch strings.ToLower(o.Type) {
+	case "cone":
+		if o.Radius <= 0 || o.Radius > 180 {
+			return nil, fmt.Errorf("lsst: cone radius %v out of (0, 180]", o.Radius)
+		}
+		if err := checkRaDec(o.Center); err != nil {
+			return nil, err
+		}
+		return Cone{Center: o.Center, Radius: o.Radius}, nil
+
+	case "box":
+		for _, v := range []RaDec{o.Min, o.Max} {
+			if err := checkRaDec(v); err != nil {
+				return nil, err
+			}
+		}
+		if o.Min.Dec > o.Max.Dec {
+			return nil, fmt.Errorf("lsst: box has an empty dec range [%v, %v]", o.Min.Dec, o.Max.Dec)
+		}
+		return Box{Min: o.Min, Max: o.Max}, nil
+
+	case "polygon":
+		vertices := make([]RaDec, len(o.Vertices))
+		for i, v := range o.Vertices {
+			vertices[i] = RaDec{Ra: v[0], Dec: v[1]}
+			if err := checkRaDec(vertices[i]); err != nil {
+				return nil, err
+			}
+		}
+		return NewPolygon(vertices)
+	}
+	return nil, fmt.Errorf("lsst: invalid region type %q (want cone|box|polygon)", o.Type)
+}
+
+// NewRegion creates the union of the regions described by opts.
+func NewRegion(opts []RegionOptions) (Region, error) {
+	u := make(Union, 0, len(opts))
+	for _, o := range opts {
+		r, err := o.New()
+		if err != nil {
+			return nil, err
+		}
+		u = append(u, r)
+	}
+	if len(u) == 1 {
+		return u[0], nil
+	}
+	return u, nil
+}
+
+// checkRaDec checks p is a valid direction.
+func checkRaDec(p RaDec) error {
+	if p.Ra < 0 || p.Ra > 360 {
+		return fmt.Errorf("lsst: ra=%v out of [0, 360]", p.Ra)
+	}
+	if p.Dec < -90 || p.Dec > 90 {
+		return fmt.Errorf("lsst: dec=%v out of [-90, 90]", p.Dec)
+	}
+	return nil
+}
+
+// AngDist returns the angular distance between a and b, in degrees.
+func AngDist(a, b RaDec) float64 {
+	// haversine formula: accurate at small distances.
+	dra := (b.Ra - a.Ra) * deg2rad
+	dec1 := a.Dec * deg2rad
+	dec2 := b.Dec * deg2rad
+	sdec := math.Sin(0.5 * (dec2 - dec1))
+	sra := math.Sin(0.5 * dra)
+	h := sdec*sdec + math.Cos(dec1)*math.Cos(dec2)*sra*sra
+	return 2 * math.Asin(math.Min(1, math.Sqrt(h))) * rad2deg
+}
+
+// vec3 is a 3-vector.
+type vec3 [3]float64
+
+// unitVec returns the unit vector pointing to p.
+func unitVec(p RaDec) vec3 {
+	ra := p.Ra * deg2rad
+	dec := p.Dec * deg2rad
+	cdec := math.Cos(dec)
+	return vec3{cdec * math.Cos(ra), cdec * math.Sin(ra), math.Sin(dec)}
+}
+
+func (a vec3) add(b vec3) vec3      { return vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a vec3) scale(f float64) vec3 { return vec3{f * a[0], f * a[1], f * a[2]} }
+func (a vec3) dot(b vec3) float64   { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func (a vec3) norm() float64        { return math.Sqrt(a.dot(a)) }
+func (a vec3) cross(b vec3) vec3 {
+	return vec3{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
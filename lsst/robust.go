@@ -0,0 +1,97 @@
+package lsst
+
+import (
+	"math"
+	"sort"
+)
+
+// madToSigma converts the median absolute deviation of a gaussian sample
+// into its standard deviation.
+const madToSigma = 1.4826
+
+// RobustStats holds outlier-resistant statistics of flux measurements.
+type RobustStats struct {
+	N      int     // number of measurements
+	Median float64 // median of the measurements
+	MAD    float64 // median absolute deviation from the median
+	Sigma  float64 // MAD-based estimate of the standard deviation
+
+	ClipMean  float64 // mean of the measurements kept by sigma clipping
+	ClipSigma float64 // standard deviation of the measurements kept by sigma clipping
+	NClip     int     // number of measurements rejected by sigma clipping
+}
+
+// NewRobustStats computes the robust statistics of the fluxes xs.
+// Measurements further than nsigma standard deviations from the median are
+// iteratively rejected, at most maxiter times.
+func NewRobustStats(xs []float64, nsigma float64, maxiter int) RobustStats {
+	stats := RobustStats{N: len(xs)}
+	if len(xs) == 0 {
+		return stats
+	}
+
+	sorted := make([]float64, len(xs))
+	copy(sorted, xs)
+	sort.Float64s(sorted)
+
+	stats.Median = median(sorted)
+
+	devs := make([]float64, len(sorted))
+	for i, x := range sorted {
+		devs[i] = math.Abs(x - stats.Median)
+	}
+	sort.Float64s(devs)
+	stats.MAD = median(devs)
+	stats.Sigma = madToSigma * stats.MAD
+
+	// sigma clipping: sorted[beg:end] holds the measurements kept.
+	beg, end := 0, len(sorted)
+	for iter := 0; iter < maxiter; iter++ {
+		kept := sorted[beg:end]
+		_, sigma := meanStdDev(kept)
+		if sigma == 0 {
+			break
+		}
+		center := median(kept)
+		lo := sort.SearchFloat64s(sorted, center-nsigma*sigma)
+		hi := sort.Search(len(sorted), func(i int) bool {
+			return sorted[i] > center+nsigma*sigma
+		})
+		// measurements rejected once stay rejected.
+		if lo < beg {
+			lo = beg
+		}
+		if hi > end {
+			hi = end
+		}
+		if lo == beg && hi == end {
+			break
+		}
+		beg, end = lo, hi
+	}
+
+	stats.ClipMean, stats.ClipSigma = meanStdDev(sorted[beg:end])
+	stats.NClip = len(sorted) - (end - beg)
+	return stats
+}
+
+// median returns the median of the sorted values xs.
+func median(xs []float64) float64 {
+	n := len(xs)
+	switch {
+	case n == 0:
+		return 0
+	case n%2 == 1:
+		return xs[n/2]
+	}
+	return 0.5 * (xs[n/2-1] + xs[n/2])
+}
+
+// meanStdDev returns the mean and sample standard deviation of xs.
+func meanStdDev(xs []float64) (mean, sigma float64) {
+	var rec FluxRec
+	for _, x := range xs {
+		rec.Add(x)
+	}
+	return rec.Mean(), rec.StdDev()
+}
@@ -0,0 +1,307 @@
+package lsst
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Sample is an individual flux measurement.
+type Sample struct {
+	Flux    float64
+	FluxErr float64
+	MJD     float64 // epoch of the measurement (0: unknown)
+	RaDec   RaDec
+	Run     int32
+	Field   int32
+}
+
+// sampleKey identifies the measurements of an object in a filter.
+type sampleKey struct {
+	OID    int64
+	Filter int32
+}
+
+// sampleRec is the on-disk record of a measurement.
+type sampleRec struct {
+	OID    int64
+	Filter int32
+	Sample Sample
+}
+
+// SampleStore keeps the individual flux measurements of each object and filter.
+//
+// At most MaxSamples measurements are kept in memory: beyond, they are
+// spilled to partition files under Dir, each object being assigned to
+// a partition by its id. Measurements are then retrieved one partition
+// at a time, so only the measurements of a partition need to fit in memory.
+type SampleStore struct {
+	Dir        string // directory of the partition files
+	MaxSamples int    // maximum number of measurements kept in memory
+	Partitions int    // number of partition files
+
+	mem   map[sampleKey][]Sample
+	n     int // number of measurements in memory
+	files []*os.File
+	sizes []int64 // number of bytes of each partition file
+}
+
+// NewSampleStore creates a new store, spilling measurements to partition
+// files under dir.
+func NewSampleStore(dir string, maxSamples, partitions int) *SampleStore {
+	return &SampleStore{
+		Dir:        dir,
+		MaxSamples: maxSamples,
+		Partitions: partitions,
+		mem:        make(map[sampleKey][]Sample),
+		files:      make([]*os.File, partitions),
+		sizes:      make([]int64, partitions),
+	}
+}
+
+// Add adds a flux measurement of object oid in filter.
+func (s *SampleStore) Add(oid int64, filter int, v Sample) error {
+	key := sampleKey{OID: oid, Filter: int32(filter)}
+	s.mem[key] = append(s.mem[key], v)
+	s.n += 1
+	if s.n < s.MaxSamples {
+		return nil
+	}
+	return s.Flush()
+}
+
+// partition returns the index of the partition of object oid.
+func (s *SampleStore) partition(oid int64) int {
+	h := uint64(oid) * 0x9e3779b97f4a7c15 // Fibonacci hashing
+	return int(h % uint64(s.Partitions))
+}
+
+func (s *SampleStore) fname(i int) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("samples-%03d.bin", i))
+}
+
+// open opens the i-th partition file for writing.
+// Data beyond the known size of the file (from a previous job) is discarded.
+func (s *SampleStore) open(i int) (*os.File, error) {
+	if s.files[i] != nil {
+		return s.files[i], nil
+	}
+
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(s.fname(i), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Truncate(s.sizes[i])
+	if err == nil {
+		_, err = f.Seek(s.sizes[i], 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.files[i] = f
+	return f, nil
+}
+
+// Flush writes the measurements held in memory to the partition files.
+func (s *SampleStore) Flush() error {
+	if s.n == 0 {
+		return nil
+	}
+
+	// group the records by partition
+	recs := make([][]sampleRec, s.Partitions)
+	for _, key := range s.keys() {
+		i := s.partition(key.OID)
+		for _, v := range s.mem[key] {
+			recs[i] = append(recs[i], sampleRec{key.OID, key.Filter, v})
+		}
+	}
+
+	for i, recs := range recs {
+		if len(recs) == 0 {
+			continue
+		}
+		f, err := s.open(i)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		err = binary.Write(w, binary.LittleEndian, recs)
+		if err != nil {
+			return err
+		}
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+		s.sizes[i] += int64(len(recs) * binary.Size(sampleRec{}))
+	}
+
+	s.mem = make(map[sampleKey][]Sample)
+	s.n = 0
+	return nil
+}
+
+// keys returns the sorted keys of the measurements held in memory.
+func (s *SampleStore) keys() []sampleKey {
+	keys := make([]sampleKey, 0, len(s.mem))
+	for key := range s.mem {
+		keys = append(keys, key)
+	}
+	sort.Sort(sampleKeys(keys))
+	return keys
+}
+
+// Each calls f with the measurements of each object and filter.
+func (s *SampleStore) Each(f func(oid int64, filter int, samples []Sample) error) error {
+	spilled := false
+	for _, size := range s.sizes {
+		if size > 0 {
+			spilled = true
+		}
+	}
+
+	if spilled {
+		err := s.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	each := func() error {
+		for _, key := range s.keys() {
+			err := f(key.OID, int(key.Filter), s.mem[key])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !spilled {
+		return each()
+	}
+
+	for i := range s.sizes {
+		err := s.load(i)
+		if err != nil {
+			return err
+		}
+		err = each()
+		if err != nil {
+			return err
+		}
+	}
+	s.mem = make(map[sampleKey][]Sample)
+	s.n = 0
+	return nil
+}
+
+// load loads the measurements of the i-th partition file in memory.
+func (s *SampleStore) load(i int) error {
+	s.mem = make(map[sampleKey][]Sample)
+	s.n = 0
+	if s.sizes[i] == 0 {
+		return nil
+	}
+
+	f, err := s.open(i)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, 0, s.sizes[i]))
+	recs := make([]sampleRec, int(s.sizes[i])/binary.Size(sampleRec{}))
+	err = binary.Read(r, binary.LittleEndian, recs)
+	if err != nil {
+		return fmt.Errorf("lsst: error reading samples from [%s]: %v", s.fname(i), err)
+	}
+
+	for _, rec := range recs {
+		key := sampleKey{OID: rec.OID, Filter: rec.Filter}
+		s.mem[key] = append(s.mem[key], rec.Sample)
+	}
+	s.n = len(recs)
+	return nil
+}
+
+// Checkpoint flushes the measurements to the partition files and returns
+// the size of each file.
+func (s *SampleStore) Checkpoint() ([]int64, error) {
+	err := s.Flush()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, len(s.sizes))
+	copy(sizes, s.sizes)
+	return sizes, nil
+}
+
+// Restore restores the state of the store from the sizes of the partition
+// files saved at a checkpoint.
+// Measurements written after the checkpoint are discarded.
+func (s *SampleStore) Restore(sizes []int64) error {
+	if len(sizes) != s.Partitions {
+		return fmt.Errorf("lsst: checkpoint has %d sample partitions (want=%d)", len(sizes), s.Partitions)
+	}
+	for i, f := range s.files {
+		if f != nil {
+			return fmt.Errorf("lsst: sample partition [%s] already open", s.fname(i))
+		}
+	}
+	copy(s.sizes, sizes)
+	s.mem = make(map[sampleKey][]Sample)
+	s.n = 0
+	return nil
+}
+
+// Close closes the partition files.
+// The files are kept on disk, to resume from a checkpoint.
+func (s *SampleStore) Close() error {
+	var err error
+	for i, f := range s.files {
+		if f == nil {
+			continue
+		}
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+		s.files[i] = nil
+	}
+	return err
+}
+
+// Remove closes and removes the partition files.
+func (s *SampleStore) Remove() error {
+	err := s.Close()
+	for i := range s.files {
+		e := os.Remove(s.fname(i))
+		if e != nil && !os.IsNotExist(e) && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+type sampleKeys []sampleKey
+
+func (p sampleKeys) Len() int      { return len(p) }
+func (p sampleKeys) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p sampleKeys) Less(i, j int) bool {
+	if p[i].OID != p[j].OID {
+		return p[i].OID < p[j].OID
+	}
+	return p[i].Filter < p[j].Filter
+}
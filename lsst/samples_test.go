@@ -0,0 +1,123 @@
+package lsst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// storeFluxes returns the fluxes of the store, by object id and filter.
+func storeFluxes(s *SampleStore) (map[string][]float64, error) {
+	out := make(map[string][]float64)
+	err := s.Each(func(oid int64, filter int, samples []Sample) error {
+		key := fmt.Sprintf("%d-%d", oid, filter)
+		if _, dup := out[key]; dup {
+			return fmt.Errorf("measurements of %s iterated over twice", key)
+		}
+		for _, v := range samples {
+			out[key] = append(out[key], v.Flux)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func TestSampleStoreRestore(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		maxSamples int
+		partitions int
+		ckpt       int // number of measurements before the checkpoint
+		lost       int // number of measurements added after the checkpoint, then lost
+		resumed    int // number of measurements added after the restore
+	}{
+		{name: "in-memory", maxSamples: 1000, partitions: 4, ckpt: 50, lost: 30, resumed: 20},
+		{name: "spilled", maxSamples: 7, partitions: 4, ckpt: 50, lost: 30, resumed: 20},
+		{name: "one-partition", maxSamples: 7, partitions: 1, ckpt: 50, lost: 30, resumed: 20},
+		{name: "empty-checkpoint", maxSamples: 7, partitions: 3, ckpt: 0, lost: 30, resumed: 20},
+		{name: "nothing-resumed", maxSamples: 7, partitions: 3, ckpt: 50, lost: 30, resumed: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "samples")
+			add := func(s *SampleStore, beg, end int) {
+				for i := beg; i < end; i++ {
+					err := s.Add(int64(i%10), i%3, Sample{Flux: float64(i)})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			s := NewSampleStore(dir, tc.maxSamples, tc.partitions)
+			add(s, 0, tc.ckpt)
+			sizes, err := s.Checkpoint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			add(s, tc.ckpt, tc.ckpt+tc.lost)
+			err = s.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// resume the job: the measurements after the checkpoint are
+			// discarded, and added anew.
+			r := NewSampleStore(dir, tc.maxSamples, tc.partitions)
+			err = r.Restore(sizes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			add(r, tc.ckpt, tc.ckpt+tc.resumed)
+			got, err := storeFluxes(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the same measurements, in a single job.
+			ref := NewSampleStore(filepath.Join(t.TempDir(), "ref"), 1000, tc.partitions)
+			add(ref, 0, tc.ckpt+tc.resumed)
+			want, err := storeFluxes(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("restored store:\ngot= %v\nwant=%v", got, want)
+			}
+
+			err = r.Remove()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if files, _ := os.ReadDir(dir); len(files) != 0 {
+				t.Fatalf("files left after Remove: %v", files)
+			}
+		})
+	}
+}
+
+func TestSampleStoreRestoreErrors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "samples")
+	s := NewSampleStore(dir, 1, 4)
+	defer s.Remove()
+
+	err := s.Restore(make([]int64, 3))
+	if err == nil {
+		t.Fatalf("expected an error restoring 3 partitions into 4")
+	}
+
+	err = s.Add(1, 0, Sample{Flux: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Restore(make([]int64, 4))
+	if err == nil {
+		t.Fatalf("expected an error restoring an open store")
+	}
+}
@@ -0,0 +1,194 @@
+package lsst
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SelectionOptions configures the selection of sources on their fluxes,
+// magnitudes and colors.
+type SelectionOptions struct {
+	Filters map[string]FilterCut // cuts on the measurements in each filter, by filter name
+	Colors  []ColorCut           // cuts on the colors of the sources
+}
+
+// FilterCut selects sources on their measurements in a filter.
+// Windows are inclusive, and not applied when unset (both bounds 0).
+type FilterCut struct {
+	MinN int        // minimum number of measurements
+	Flux [2]float64 // window on the mean flux
+	Mag  [2]float64 // window on the magnitude
+}
+
+// ColorCut selects sources on a color: the difference of their magnitudes
+// in two filters, named as "g-r".
+type ColorCut struct {
+	Color string
+	Range [2]float64
+}
+
+// NeedMags returns whether the selection has cuts on magnitudes or colors.
+func (o SelectionOptions) NeedMags() bool {
+	if len(o.Colors) > 0 {
+		return true
+	}
+	for _, cut := range o.Filters {
+		if cut.Mag != [2]float64{} {
+			return true
+		}
+	}
+	return false
+}
+
+// names returns the names of the filters of the cuts, sorted.
+func (o SelectionOptions) names() []string {
+	names := make([]string, 0, len(o.Filters))
+	for name := range o.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseColor returns the names of the two filters of the color c.
+func parseColor(c string) (string, string, error) {
+	toks := strings.Split(c, "-")
+	if len(toks) != 2 || toks[0] == "" || toks[1] == "" {
+		return "", "", fmt.Errorf("lsst: invalid color %q (want such as \"g-r\")", c)
+	}
+	return toks[0], toks[1], nil
+}
+
+// check checks the windows and colors of the options are valid.
+func (o SelectionOptions) check() []error {
+	var errs []error
+	errorf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	window := func(name string, w [2]float64) {
+		if w != [2]float64{} && w[0] > w[1] {
+			errorf("%s: empty range [%v, %v]", name, w[0], w[1])
+		}
+	}
+
+	for _, name := range o.names() {
+		cut := o.Filters[name]
+		if cut.MinN < 0 {
+			errorf("Selection.Filters.%s.MinN: invalid value %d", name, cut.MinN)
+		}
+		window(fmt.Sprintf("Selection.Filters.%s.Flux", name), cut.Flux)
+		window(fmt.Sprintf("Selection.Filters.%s.Mag", name), cut.Mag)
+	}
+
+	for i, cut := range o.Colors {
+		if _, _, err := parseColor(cut.Color); err != nil {
+			errorf("Selection.Colors[%d]: %v", i, err)
+		}
+		window(fmt.Sprintf("Selection.Colors[%d].Range", i), cut.Range)
+	}
+	return errs
+}
+
+// Selector selects sources on the measurements of the filters of a job.
+type Selector struct {
+	flux   [2]float64  // window on the mean flux in every filter
+	cuts   []FilterCut // cuts in each filter of the job
+	colors []colorCut
+}
+
+type colorCut struct {
+	i, j int // filters of the color, in the job filters
+	rng  [2]float64
+}
+
+// NewSelector creates the selector of the sources of a job with the filters
+// (ids in the filter set fs), applying the window flux (if set) to the mean
+// flux in every filter, on top of the cuts of opts.
+func NewSelector(opts SelectionOptions, flux [2]float64, fs FilterSet, filters []int) (*Selector, error) {
+	sel := &Selector{
+		flux: flux,
+		cuts: make([]FilterCut, len(filters)),
+	}
+
+	index := func(name string) (int, error) {
+		b, err := fs.Parse(name)
+		if err != nil {
+			return 0, err
+		}
+		id, err := fs.ID(b)
+		if err != nil {
+			return 0, err
+		}
+		for i, filter := range filters {
+			if filter == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("lsst: selection filter %q is not a filter of the job", name)
+	}
+
+	for _, name := range opts.names() {
+		i, err := index(name)
+		if err != nil {
+			return nil, err
+		}
+		sel.cuts[i] = opts.Filters[name]
+	}
+
+	for _, cut := range opts.Colors {
+		f1, f2, err := parseColor(cut.Color)
+		if err != nil {
+			return nil, err
+		}
+		i, err := index(f1)
+		if err != nil {
+			return nil, err
+		}
+		j, err := index(f2)
+		if err != nil {
+			return nil, err
+		}
+		sel.colors = append(sel.colors, colorCut{i: i, j: j, rng: cut.Range})
+	}
+
+	return sel, nil
+}
+
+// inWindow returns whether v is inside the window w, or w is unset.
+func inWindow(v float64, w [2]float64) bool {
+	return w == [2]float64{} || (v >= w[0] && v <= w[1])
+}
+
+// Select returns whether the source m passes the cuts.
+// Flux and magnitude windows only apply to the filters in which the source
+// has measurements: MinN requires measurements in a filter.
+// Magnitude and color cuts need the magnitudes of the source.
+func (sel *Selector) Select(m FPMeasure) bool {
+	for i, cut := range sel.cuts {
+		flux := m.Fluxes[i]
+		if flux.N < cut.MinN {
+			return false
+		}
+		if flux.N == 0 {
+			continue
+		}
+		if !inWindow(flux.Mean(), sel.flux) || !inWindow(flux.Mean(), cut.Flux) {
+			return false
+		}
+		if cut.Mag != [2]float64{} && !(i < len(m.Mags) && inWindow(m.Mags[i].Mag, cut.Mag)) {
+			return false
+		}
+	}
+
+	for _, cut := range sel.colors {
+		if cut.i >= len(m.Mags) || cut.j >= len(m.Mags) {
+			return false
+		}
+		if !inWindow(m.Mags[cut.i].Mag-m.Mags[cut.j].Mag, cut.rng) {
+			return false
+		}
+	}
+	return true
+}
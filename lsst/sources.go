@@ -0,0 +1,120 @@
+package lsst
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	fits "github.com/astrogo/fitsio"
+)
+
+// Source is a row of a forced-photometry table.
+// The flux error is read from the column configured in the SourceReader,
+// and is NaN when the table has no such column.
+type Source struct {
+	ID      int64      `fits:"id"`
+	OID     int64      `fits:"objectId"`
+	Flux    float64    `fits:"flux_psf"`
+	FluxErr float64    `fits:"flux_psf_err"`
+	RefFlux float64    `fits:"refFlux"`
+	Coord   [2]float64 `fits:"coord"` // ra, dec in radians
+}
+
+// RaDec returns the position of the source, in degrees.
+func (src Source) RaDec() RaDec {
+	return RaDec{Ra: src.Coord[0] * rad2deg, Dec: src.Coord[1] * rad2deg}
+}
+
+var sourceType = reflect.TypeOf(Source{})
+
+// SourceReader reads the rows of forced-photometry tables.
+type SourceReader struct {
+	FluxErr string // name of the flux error column
+
+	typ    reflect.Type // Source, with the flux error read from the FluxErr column
+	noErr  reflect.Type // Source, without the flux error
+	errIdx int          // index of the FluxErr field in Source
+}
+
+// NewSourceReader creates a reader of forced-photometry tables, with the flux
+// error read from the column fluxerr (default: DefaultFluxErr).
+func NewSourceReader(fluxerr string) *SourceReader {
+	if fluxerr == "" {
+		fluxerr = DefaultFluxErr
+	}
+
+	var (
+		fields = make([]reflect.StructField, sourceType.NumField())
+		noErr  []reflect.StructField
+		errIdx = -1
+	)
+	for i := range fields {
+		fields[i] = sourceType.Field(i)
+		if fields[i].Name == "FluxErr" {
+			fields[i].Tag = reflect.StructTag(fmt.Sprintf("fits:%q", fluxerr))
+			errIdx = i
+			continue
+		}
+		noErr = append(noErr, fields[i])
+	}
+
+	return &SourceReader{
+		FluxErr: fluxerr,
+		typ:     reflect.StructOf(fields),
+		noErr:   reflect.StructOf(noErr),
+		errIdx:  errIdx,
+	}
+}
+
+// HasFluxErr returns whether the table has the flux error column.
+func (r *SourceReader) HasFluxErr(table *fits.Table) bool {
+	return table.Index(r.FluxErr) >= 0
+}
+
+// Read reads all the rows of the table.
+// Without the flux error column, flux errors are NaN.
+func (r *SourceReader) Read(table *fits.Table) ([]Source, error) {
+	hasErr := r.HasFluxErr(table)
+	typ := r.typ
+	if !hasErr {
+		typ = r.noErr
+	}
+
+	nrows := table.NumRows()
+	rows, err := table.Read(0, nrows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	srcs := make([]Source, 0, int(nrows))
+	row := reflect.New(typ)
+	for rows.Next() {
+		err = rows.Scan(row.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if hasErr {
+			srcs = append(srcs, row.Elem().Convert(sourceType).Interface().(Source))
+			continue
+		}
+
+		src := Source{FluxErr: math.NaN()}
+		dst := reflect.ValueOf(&src).Elem()
+		for i, j := 0, 0; i < dst.NumField(); i++ {
+			if i == r.errIdx {
+				continue
+			}
+			dst.Field(i).Set(row.Elem().Field(j))
+			j++
+		}
+		srcs = append(srcs, src)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return srcs, err
+}
@@ -0,0 +1,210 @@
+package lsst
+
+import (
+	"math"
+	"sort"
+)
+
+// Variability holds the variability indices of the measurements of a source
+// in a filter. Only the measurements with a finite flux and a valid (positive)
+// flux error are used. Indices are NaN with less than 2 such measurements.
+type Variability struct {
+	N         int     // number of measurements
+	WMean     float64 // inverse-variance weighted mean of the fluxes
+	Chi2      float64 // chi-square of the fluxes against the constant WMean
+	ExcessVar float64 // normalized excess variance of the fluxes
+	StetsonJ  float64 // Stetson J index (single observations)
+	StetsonK  float64 // Stetson K index (kurtosis of the residuals)
+	Eta       float64 // von Neumann ratio of the fluxes in time order (see NewVariability)
+	Amplitude float64 // half the difference between the largest and smallest flux
+}
+
+// RedChi2 returns the reduced chi-square of the fluxes against a constant.
+func (v Variability) RedChi2() float64 {
+	if v.N < 2 {
+		return math.NaN()
+	}
+	return v.Chi2 / float64(v.N-1)
+}
+
+type samplesByMJD []Sample
+
+func (p samplesByMJD) Len() int { return len(p) }
+func (p samplesByMJD) Less(i, j int) bool {
+	// measurements without a known epoch (0) go last
+	switch {
+	case p[i].MJD == 0:
+		return false
+	case p[j].MJD == 0:
+		return true
+	}
+	return p[i].MJD < p[j].MJD
+}
+func (p samplesByMJD) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// NewVariability computes the variability indices of the measurements of a
+// source in a filter.
+// The measurements are sorted in place by epoch, followed by the measurements
+// without a known epoch (0) in their original order.
+// The von Neumann ratio is computed from the measurements with a known epoch
+// only or, when no epoch is known, from all the measurements in their
+// original order.
+func NewVariability(samples []Sample) Variability {
+	sort.Stable(samplesByMJD(samples))
+
+	var (
+		v     = Variability{}
+		n     = 0
+		sum   = 0.0          // sum of the fluxes
+		sumw  = 0.0          // sum of the weights
+		sumwx = 0.0          // weighted sum of the fluxes
+		sume2 = 0.0          // sum of the squared errors
+		lo    = math.Inf(+1) // smallest flux
+		hi    = math.Inf(-1) // largest flux
+		dated = 0            // number of measurements with a known epoch
+	)
+	valid := func(s Sample) bool {
+		return !math.IsNaN(s.Flux) && !math.IsInf(s.Flux, 0) &&
+			s.FluxErr > 0 && !math.IsInf(s.FluxErr, 0)
+	}
+
+	for _, s := range samples {
+		if !valid(s) {
+			continue
+		}
+		n++
+		w := 1 / (s.FluxErr * s.FluxErr)
+		sum += s.Flux
+		sumw += w
+		sumwx += w * s.Flux
+		sume2 += s.FluxErr * s.FluxErr
+		lo = math.Min(lo, s.Flux)
+		hi = math.Max(hi, s.Flux)
+		if s.MJD != 0 {
+			dated++
+		}
+	}
+
+	v.N = n
+	if n < 2 {
+		nan := math.NaN()
+		v.WMean = nan
+		if n == 1 {
+			v.WMean = sumwx / sumw
+		}
+		v.Chi2 = nan
+		v.ExcessVar = nan
+		v.StetsonJ = nan
+		v.StetsonK = nan
+		v.Eta = nan
+		v.Amplitude = nan
+		return v
+	}
+
+	var (
+		fn    = float64(n)
+		mean  = sum / fn
+		wmean = sumwx / sumw
+		norm  = math.Sqrt(fn / (fn - 1))
+		ss    = 0.0 // sum of the squared deviations from the mean
+		sumd  = 0.0 // sum of the absolute residuals
+		sumd2 = 0.0 // sum of the squared residuals
+		sumj  = 0.0
+		xs    = make([]float64, 0, n) // fluxes in time order, for the von Neumann ratio
+	)
+	for _, s := range samples {
+		if !valid(s) {
+			continue
+		}
+		ss += (s.Flux - mean) * (s.Flux - mean)
+		if dated == 0 || s.MJD != 0 {
+			xs = append(xs, s.Flux)
+		}
+
+		r := (s.Flux - wmean) / s.FluxErr
+		d := norm * r // residual of Stetson (1996)
+		v.Chi2 += r * r
+		sumd += math.Abs(d)
+		sumd2 += d * d
+
+		p := d*d - 1
+		if p >= 0 {
+			sumj += math.Sqrt(p)
+		} else {
+			sumj -= math.Sqrt(-p)
+		}
+	}
+
+	variance := ss / (fn - 1)
+	v.WMean = wmean
+	v.ExcessVar = (variance - sume2/fn) / (mean * mean)
+	v.StetsonJ = sumj / fn
+	v.StetsonK = (sumd / fn) / math.Sqrt(sumd2/fn)
+	v.Eta = vonNeumann(xs)
+	v.Amplitude = 0.5 * (hi - lo)
+	return v
+}
+
+// vonNeumann returns the von Neumann ratio of the values xs: the mean square
+// successive difference over the variance.
+func vonNeumann(xs []float64) float64 {
+	n := len(xs)
+	if n < 2 {
+		return math.NaN()
+	}
+	mean, dd := 0.0, 0.0
+	for i, x := range xs {
+		mean += x
+		if i > 0 {
+			dd += (x - xs[i-1]) * (x - xs[i-1])
+		}
+	}
+	mean /= float64(n)
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return (dd / float64(n-1)) / (ss / float64(n-1))
+}
+
+// VariabilityOptions configures the variability indices of the fluxes of
+// each source and the selection of variable candidates.
+// A source is a candidate in a filter when it has at least MinN measurements
+// in that filter and its indices pass all the thresholds which are set
+// (a zero threshold is not applied).
+type VariabilityOptions struct {
+	Enable    bool
+	MinN      int     // minimum number of measurements (default: 5)
+	Chi2      float64 // minimum reduced chi-square against a constant
+	ExcessVar float64 // minimum normalized excess variance
+	StetsonJ  float64 // minimum Stetson J index
+	Eta       float64 // maximum von Neumann ratio
+	Amplitude float64 // minimum amplitude
+}
+
+// WithDefaults returns the options, with default values for unset ones.
+func (o VariabilityOptions) WithDefaults() VariabilityOptions {
+	if o.MinN == 0 {
+		o.MinN = 5
+	}
+	return o
+}
+
+// Select returns whether the variability indices v pass the thresholds.
+func (o VariabilityOptions) Select(v Variability) bool {
+	switch {
+	case v.N < 2 || v.N < o.MinN:
+		return false
+	case o.Chi2 != 0 && !(v.RedChi2() >= o.Chi2):
+		return false
+	case o.ExcessVar != 0 && !(v.ExcessVar >= o.ExcessVar):
+		return false
+	case o.StetsonJ != 0 && !(v.StetsonJ >= o.StetsonJ):
+		return false
+	case o.Eta != 0 && !(v.Eta <= o.Eta):
+		return false
+	case o.Amplitude != 0 && !(v.Amplitude >= o.Amplitude):
+		return false
+	}
+	return true
+}